@@ -2,6 +2,7 @@ package hmm
 
 import (
    "encoding/json"
+   "strings"
 )
 
 type BasicHMM struct {
@@ -29,23 +30,14 @@ func MakeBasicHMM (n, m int) *BasicHMM {
    return p
 }
 
+// nil when raw is not a model of consistent shape; Load reports the error
+// and also checks the probabilities.
 func ParseBasicHMM (raw string) *BasicHMM {
-   var tmp struct {
-      N  int
-      M  int
-      A  [][]float64
-      B  [][]float64
-      Pi []float64
-   }
-   err := json.Unmarshal([]byte(raw), &tmp)
+   m, err := Load(strings.NewReader(raw), -1)
    if err != nil {
       return nil
    }
-   hmm := MakeBasicHMM(tmp.N, tmp.M)
-   hmm.FillA(tmp.A)
-   hmm.FillB(tmp.B)
-   hmm.FillPi(tmp.Pi)
-   return hmm
+   return m.HMM
 }
 
 func StringifyBasicHMM (hmm *BasicHMM) string {
@@ -175,6 +167,9 @@ func (h *BasicHMM) Scale () HiddenMarkovModel {
          newhmm.SetB(i, j, newhmm.B(i, j) / s2)
       }
    }
+   if s3 == 0.0 {
+      s3 = 1.0
+   }
    for i := 0; i < n; i++ {
       newhmm.SetPi(i, newhmm.Pi(i) / s3)
    }
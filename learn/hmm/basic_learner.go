@@ -30,6 +30,10 @@ func ExpandBasicHMM (hmm *BasicHMM, newN, newM int) *BasicHMM {
    return newhmm
 }
 
+// Add importance to the counts of one labelled sequence: Pi of the first
+// state, A of every transition and B of every (state, observation) pair.
+// hmm grows to fit new states and symbols. The counts are not normalized;
+// see SupervisedTrainer for a normalized, smoothed model.
 func BasicLearner (hmm *BasicHMM, observation, state []int, importance float64) *BasicHMM {
    // should stn === obn
    stn    := len(state)
@@ -46,7 +50,7 @@ func BasicLearner (hmm *BasicHMM, observation, state []int, importance float64)
    }
 
    hmm.SetPi(state[0], hmm.Pi(state[0]) + importance)
-   hmm.SetB(0, observation[0], hmm.B(0, observation[0]) + importance)
+   hmm.SetB(state[0], observation[0], hmm.B(state[0], observation[0]) + importance)
    for i := 1; i < stn; i++ {
       hmm.SetA(state[i-1], state[i], hmm.A(state[i-1], state[i]) + importance)
       hmm.SetB(state[i], observation[i], hmm.B(state[i], observation[i]) + importance)
@@ -1,7 +1,12 @@
 package hmm
 
+import (
+   "math"
+)
+
+// Train hmm on one observation sequence for a fixed number of iterations;
+// need_init starts from uniform A, B and Pi. See BaumWelchTrainer.
 func BaumWelchLeaner (need_init bool, hmm HiddenMarkovModel, observation []int, times int) {
-   obn  := len(observation)
    stn  := hmm.N()
    m    := hmm.M()
    mavg := 1.0 / float64(m)
@@ -18,98 +23,151 @@ func BaumWelchLeaner (need_init bool, hmm HiddenMarkovModel, observation []int,
          hmm.SetPi(i, navg)
       }
    }
+   BaumWelchTrainer(hmm, [][]int{observation}, math.Inf(-1), times)
+}
 
-   // learn loop
-   var s1, s2, gamman, xin float64
-   newhmm := MakeBasicHMM(stn, m)
-   newhmm.FillA(*hmm.GetA())
-   newhmm.FillB(*hmm.GetB())
-   newhmm.FillPi(*hmm.GetPi())
-   for times > 0 {
-      s2 = 0
-      _, f := ForwardCalculator(hmm, observation)
-      _, b := BackwardCalculator(hmm, observation)
+// Re-estimate hmm in place from a set of observation sequences until the
+// total log-likelihood improves by less than tolerance or max_iterations
+// re-estimations are done. Returns the log-likelihood trajectory: the
+// likelihood before every re-estimation followed by the final one.
+//
+// Rows of A and B of states that no sequence visits are kept as they are;
+// sequences that are impossible under the model (log-likelihood -Inf) do not
+// contribute to the re-estimation.
+func BaumWelchTrainer (hmm HiddenMarkovModel, observations [][]int, tolerance float64, max_iterations int) []float64 {
+   likelihood := func () ([][][]float64, []float64) {
+      lks := make([][][]float64, len(observations))
+      for k, observation := range observations {
+         lks[k] = discrete_likelihood(hmm, observation)
+      }
+      return lks, make([]float64, len(observations))
+   }
+   reestimate := func (gamma [][][]float64) {
+      discrete_reestimate(hmm, observations, gamma)
+   }
+   return baum_welch_train(hmm, likelihood, reestimate, tolerance, max_iterations)
+}
 
-      gamman = gammaN(0, stn, f, b)
-      for i := 0; i < stn; i++ {
-         newhmm.SetPi(i, divide0(gammaM(i, 0, f, b), gamman))
+// Transition part of a model that Baum-Welch re-estimates in place.
+type baum_welch_chain interface {
+   MarkovChain
+   SetA  (i, j int, v float64) bool
+   SetPi (i int, v float64)    bool
+}
+
+// EM loop shared by every emission model: likelihood gives, per sequence, the
+// emission likelihoods lk[t][i] up to a factor exp(offset); reestimate is the
+// emission M-step given the state posteriors (nil for impossible sequences).
+func baum_welch_train (
+   chain baum_welch_chain,
+   likelihood func () ([][][]float64, []float64),
+   reestimate func (gamma [][][]float64),
+   tolerance float64, max_iterations int,
+) []float64 {
+   trajectory := make([]float64, 0, max_iterations + 1)
+   for iteration := 0; iteration < max_iterations; iteration++ {
+      lks, offsets := likelihood()
+      lnP, gamma := baum_welch_step(chain, lks, offsets, true)
+      if gamma != nil {
+         reestimate(gamma)
+      }
+      trajectory = append(trajectory, lnP)
+      if iteration > 0 && lnP - trajectory[iteration - 1] < tolerance {
+         // the last re-estimation did not pay off; this one is kept anyway
+         // as EM never lowers the likelihood
+         break
+      }
+   }
+   lks, offsets := likelihood()
+   lnP, _ := baum_welch_step(chain, lks, offsets, false)
+   return append(trajectory, lnP)
+}
+
+// Total log-likelihood of the sequences under the model (before the update);
+// when update is set, re-estimates Pi and A of chain from the expected counts
+// and returns the state posteriors of every sequence, or nil if no sequence
+// is possible.
+func baum_welch_step (chain baum_welch_chain, lks [][][]float64, offsets []float64, update bool) (float64, [][][]float64) {
+   stn := chain.N()
+   pi      := make([]float64, stn)
+   a_num   := baum_welch_matrix(stn, stn)
+   a_den   := make([]float64, stn)
+   gammas  := make([][][]float64, len(lks))
+   counted := 0
+
+   lnP := 0.0
+   for k, lk := range lks {
+      obn := len(lk)
+      if obn == 0 {
+         continue
+      }
+      lnp, forward, scale := scaled_forward(chain, lk)
+      lnP += lnp + offsets[k]
+      if math.IsInf(lnp, -1) || !update {
+         continue
       }
+      _, backward := scaled_backward(chain, lk, scale)
+      gamma := state_posterior(forward, backward)
+      xi    := transition_posterior(chain, lk, forward, backward, scale)
+      gammas[k] = gamma
+      counted ++
 
+      for i := 0; i < stn; i++ {
+         pi[i] += gamma[0][i]
+      }
       for t := 0; t < obn - 1; t++ {
-         gamman = gammaN(t, stn, f, b)
-         xin = xiN(hmm, t, stn, observation, f, b)
          for i := 0; i < stn; i++ {
+            a_den[i] += gamma[t][i]
             for j := 0; j < stn; j++ {
-               newhmm.SetA(i, j,
-                  divide0(newhmm.A(i, j) + xiM(hmm, i, j, t, observation, f, b), xin))
+               a_num[i][j] += xi[t][i][j]
             }
-            s1 = divide0(gammaM(i, t, f, b), gamman)
-            newhmm.SetB(i, observation[t], newhmm.B(i, observation[t]) + s1)
-            s2 += s1
          }
       }
+   }
+   if !update || counted == 0 {
+      return lnP, nil
+   }
 
-      gamman = gammaN(obn-1, stn, f, b)
-      for i := 0; i < stn; i++ {
+   for i := 0; i < stn; i++ {
+      chain.SetPi(i, pi[i] / float64(counted))
+      if a_den[i] > 0 {
          for j := 0; j < stn; j++ {
-            newhmm.SetA(i, j, divide0(newhmm.A(i, j), s2))
+            chain.SetA(i, j, a_num[i][j] / a_den[i])
          }
-         s1 = divide0(gammaM(i, obn-1, f, b), gamman)
-         newhmm.SetB(i, observation[obn-1], newhmm.B(i, observation[obn-1]) + s1)
-         s2 += s1
       }
-      for i := 0; i < stn; i++ {
-         for j := 0; j < m; j++ {
-            newhmm.SetB(i, j, divide0(newhmm.B(i, j), s2))
-         }
-      }
-
-      hmm.FillA(*newhmm.GetA())
-      hmm.FillB(*newhmm.GetB())
-      hmm.FillPi(*newhmm.GetPi())
-      times --
    }
+   return lnP, gammas
 }
 
-
-func divide0(m, n float64) float64 {
-   if n == 0 {
-      return 0
-   }
-   return m / n
-}
-
-// gamma = gammM / gammN
-func gammaM(i, t int, forward, backward [][]float64) float64 {
-   return forward[i][t] * backward[i][t]
-}
-
-func gammaN(t, stn int, forward, backward [][]float64) float64 {
-   var sum float64
-   for j := 0; j < stn; j++ {
-      sum += forward[j][t] * backward[j][t]
-   }
-   return sum
-}
-
-func xiM(hmm HiddenMarkovModel, i, j, t int, observation []int, forward, backward [][]float64) float64 {
-   if t == len(observation) - 1 {
-      return forward[i][t] * hmm.A(i, j)
-   } else {
-      return forward[i][t] * hmm.A(i, j) * hmm.B(j, observation[t+1]) * backward[j][t+1]
+// Emission M-step of a discrete model: B(i, k) is the expected share of
+// symbol k among the steps spent in state i. Rows of unvisited states are
+// kept.
+func discrete_reestimate (hmm HiddenMarkovModel, observations [][]int, gammas [][][]float64) {
+   stn := hmm.N()
+   m   := hmm.M()
+   b_num := baum_welch_matrix(stn, m)
+   b_den := make([]float64, stn)
+   for k, gamma := range gammas {
+      for t, row := range gamma {
+         for i, g := range row {
+            b_num[i][observations[k][t]] += g
+            b_den[i] += g
+         }
+      }
    }
-}
-
-func xiN(hmm HiddenMarkovModel, t, stn int, observation []int, forward, backward [][]float64) float64 {
-   var sum, delta float64
    for i := 0; i < stn; i++ {
-      for j := 0; j < stn; j++ {
-         delta = forward[i][t] * hmm.A(i, j)
-         if t < stn - 1 {
-            delta *= hmm.B(j, observation[t+1]) * backward[j][t+1]
+      if b_den[i] > 0 {
+         for o := 0; o < m; o++ {
+            hmm.SetB(i, o, b_num[i][o] / b_den[i])
          }
-         sum += delta
       }
    }
-   return sum
+}
+
+func baum_welch_matrix (n, m int) [][]float64 {
+   r := make([][]float64, n)
+   for i := 0; i < n; i++ {
+      r[i] = make([]float64, m)
+   }
+   return r
 }
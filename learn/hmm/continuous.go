@@ -0,0 +1,66 @@
+package hmm
+
+// Hidden Markov model with a pluggable emission model. Chain holds Pi and A;
+// its B is not used.
+type ContinuousHMM struct {
+   Chain    *BasicHMM
+   Emission Emission
+}
+
+// Uniform Pi and A over the states of emission.
+func NewContinuousHMM (emission Emission) *ContinuousHMM {
+   n := emission.N()
+   h := new(ContinuousHMM)
+   h.Chain = MakeBasicHMM(n, 0)
+   h.Emission = emission
+   for i := 0; i < n; i++ {
+      h.Chain.SetPi(i, 1.0 / float64(n))
+      for j := 0; j < n; j++ {
+         h.Chain.SetA(i, j, 1.0 / float64(n))
+      }
+   }
+   return h
+}
+
+// As ScaledForwardCalculator. Emission likelihoods are rescaled per step
+// before the recursion, so scale[t] is only meaningful relative to the other
+// steps; lnP is exact.
+func ContinuousForwardCalculator (hmm *ContinuousHMM, observation [][]float64) (lnP float64, forward [][]float64, scale []float64) {
+   lk, offset := emission_likelihood(hmm.Emission.LogLikelihood(observation))
+   lnP, forward, scale = scaled_forward(hmm.Chain, lk)
+   lnP += offset
+   return
+}
+
+// As ScaledBackwardCalculator, with scale from ContinuousForwardCalculator
+// (or nil).
+func ContinuousBackwardCalculator (hmm *ContinuousHMM, observation [][]float64, scale []float64) (lnP float64, backward [][]float64) {
+   lk, offset := emission_likelihood(hmm.Emission.LogLikelihood(observation))
+   lnP, backward = scaled_backward(hmm.Chain, lk, scale)
+   lnP += offset
+   return
+}
+
+func ContinuousViterbiCalculator (hmm *ContinuousHMM, observation [][]float64) (lnP float64, state []int) {
+   return viterbi(hmm.Chain, hmm.Emission.LogLikelihood(observation))
+}
+
+func ContinuousViterbiNBestCalculator (hmm *ContinuousHMM, observation [][]float64, k int) (lnP []float64, states [][]int) {
+   return viterbi_nbest(hmm.Chain, hmm.Emission.LogLikelihood(observation), k)
+}
+
+// As BaumWelchTrainer; the emission is refit by its Reestimate.
+func ContinuousBaumWelchTrainer (hmm *ContinuousHMM, observations [][][]float64, tolerance float64, max_iterations int) []float64 {
+   likelihood := func () ([][][]float64, []float64) {
+      lks := make([][][]float64, len(observations))
+      offsets := make([]float64, len(observations))
+      for k, observation := range observations {
+         lks[k], offsets[k] = emission_likelihood(hmm.Emission.LogLikelihood(observation))
+      }
+      return lks, offsets
+   }
+   reestimate := func (gamma [][][]float64) {
+      hmm.Emission.Reestimate(observations, gamma)
+   }
+   return baum_welch_train(hmm.Chain, likelihood, reestimate, tolerance, max_iterations)
+}
@@ -0,0 +1,54 @@
+package hmm
+
+// Decoding entry points shared by the first-order BasicHMM and the
+// SecondOrderHMM.
+type Decoder interface {
+   N () int
+   M () int
+   // ln P(observation)
+   LogLikelihood (observation []int) float64
+   // as ViterbiCalculator
+   Viterbi (observation []int) (lnP float64, state []int)
+   // as ViterbiNBestCalculator
+   ViterbiNBest (observation []int, k int) (lnP []float64, states [][]int)
+   // as StatePosteriorCalculator
+   StatePosterior (observation []int) (lnP float64, gamma [][]float64)
+   // as PosteriorDecoder
+   PosteriorDecode (observation []int) (state []int, confidence []float64)
+}
+
+func (h *BasicHMM) LogLikelihood (observation []int) float64 {
+   lnP, _, _ := ScaledForwardCalculator(h, observation)
+   return lnP
+}
+
+func (h *BasicHMM) Viterbi (observation []int) (float64, []int) {
+   return ViterbiCalculator(h, observation)
+}
+
+func (h *BasicHMM) ViterbiNBest (observation []int, k int) ([]float64, [][]int) {
+   return ViterbiNBestCalculator(h, observation, k)
+}
+
+func (h *BasicHMM) StatePosterior (observation []int) (float64, [][]float64) {
+   return StatePosteriorCalculator(h, observation)
+}
+
+func (h *BasicHMM) PosteriorDecode (observation []int) ([]int, []float64) {
+   return PosteriorDecoder(h, observation)
+}
+
+// most likely state at every step of gamma with its probability
+func posterior_decode (gamma [][]float64) (state []int, confidence []float64) {
+   state = make([]int, len(gamma))
+   confidence = make([]float64, len(gamma))
+   for t, row := range gamma {
+      for i, p := range row {
+         if p > confidence[t] {
+            state[t] = i
+            confidence[t] = p
+         }
+      }
+   }
+   return
+}
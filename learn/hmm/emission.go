@@ -0,0 +1,259 @@
+package hmm
+
+import (
+   "math"
+)
+
+// Emission part of a hidden Markov model over real-valued observations: an
+// observation sequence has one vector per time step. Plugged into a
+// ContinuousHMM, it is all forward, backward, Viterbi and Baum-Welch need.
+type Emission interface {
+   N () int
+   // ln p(observation[t] | q_t = i) as [t][i]; -Inf when impossible
+   LogLikelihood (observation [][]float64) [][]float64
+   // Baum-Welch M-step: refit to the sequences weighted by the state
+   // posteriors gamma[k][t][i] = P(q_t = i | observations[k]); gamma[k] is
+   // nil for sequences that do not count.
+   Reestimate (observations [][][]float64, gamma [][][]float64)
+}
+
+// exp of an emission log-likelihood matrix, every row divided by its largest
+// entry so that high-dimensional densities neither underflow nor overflow;
+// offset is the ln of the product of the divisors.
+func emission_likelihood (emission [][]float64) (lk [][]float64, offset float64) {
+   lk = make([][]float64, len(emission))
+   for t, row := range emission {
+      lk[t] = make([]float64, len(row))
+      max := math.Inf(-1)
+      for _, v := range row {
+         if v > max {
+            max = v
+         }
+      }
+      offset += max
+      if math.IsInf(max, 0) {
+         continue
+      }
+      for i, v := range row {
+         lk[t][i] = math.Exp(v - max)
+      }
+   }
+   return
+}
+
+// Discrete emission B of a HiddenMarkovModel as an Emission: observation[t][0]
+// is the symbol at step t.
+type DiscreteEmission struct {
+   HMM HiddenMarkovModel
+}
+
+func (e *DiscreteEmission) N () int {
+   return e.HMM.N()
+}
+
+func (e *DiscreteEmission) symbols (observation [][]float64) []int {
+   r := make([]int, len(observation))
+   for t, o := range observation {
+      r[t] = int(o[0])
+   }
+   return r
+}
+
+func (e *DiscreteEmission) LogLikelihood (observation [][]float64) [][]float64 {
+   return discrete_log_likelihood(e.HMM, e.symbols(observation))
+}
+
+func (e *DiscreteEmission) Reestimate (observations [][][]float64, gamma [][][]float64) {
+   symbols := make([][]int, len(observations))
+   for k, observation := range observations {
+      symbols[k] = e.symbols(observation)
+   }
+   discrete_reestimate(e.HMM, symbols, gamma)
+}
+
+// ln of the normal density with diagonal covariance
+func diagonal_gaussian_log_pdf (x, mean, variance []float64) float64 {
+   r := 0.0
+   for d, v := range variance {
+      diff := x[d] - mean[d]
+      r -= 0.5 * (math.Log(2 * math.Pi * v) + diff * diff / v)
+   }
+   return r
+}
+
+// Weighted mean and variance (floored at min_var) of the vectors x[k][t],
+// each weighted by w[k][t]; ok is false when all weights are zero.
+func weighted_moments (x [][][]float64, w [][]float64, dim int, min_var float64) (mean, variance []float64, ok bool) {
+   mean = make([]float64, dim)
+   variance = make([]float64, dim)
+   sum := 0.0
+   for k := range w {
+      for t, wt := range w[k] {
+         sum += wt
+         for d := 0; d < dim; d++ {
+            mean[d] += wt * x[k][t][d]
+         }
+      }
+   }
+   if sum == 0 {
+      return nil, nil, false
+   }
+   for d := range mean {
+      mean[d] /= sum
+   }
+   for k := range w {
+      for t, wt := range w[k] {
+         for d := 0; d < dim; d++ {
+            diff := x[k][t][d] - mean[d]
+            variance[d] += wt * diff * diff
+         }
+      }
+   }
+   for d := range variance {
+      variance[d] = math.Max(variance[d] / sum, min_var)
+   }
+   return mean, variance, true
+}
+
+// One normal distribution with diagonal covariance per state; a dimension of
+// 1 is the univariate case.
+type GaussianEmission struct {
+   Mean [][]float64 // [state][dimension]
+   Var  [][]float64 // [state][dimension]
+   // floor of re-estimated variances, so that a state cannot collapse on a
+   // single point
+   MinVar float64
+}
+
+func NewGaussianEmission (mean, variance [][]float64) *GaussianEmission {
+   e := new(GaussianEmission)
+   e.Mean = mean
+   e.Var = variance
+   e.MinVar = 1e-6
+   return e
+}
+
+func (e *GaussianEmission) N () int {
+   return len(e.Mean)
+}
+
+func (e *GaussianEmission) Dim () int {
+   return len(e.Mean[0])
+}
+
+func (e *GaussianEmission) LogLikelihood (observation [][]float64) [][]float64 {
+   r := make([][]float64, len(observation))
+   for t, o := range observation {
+      r[t] = make([]float64, e.N())
+      for i := range r[t] {
+         r[t][i] = diagonal_gaussian_log_pdf(o, e.Mean[i], e.Var[i])
+      }
+   }
+   return r
+}
+
+func (e *GaussianEmission) Reestimate (observations [][][]float64, gamma [][][]float64) {
+   for i := 0; i < e.N(); i++ {
+      w := make([][]float64, len(gamma))
+      for k, g := range gamma {
+         w[k] = make([]float64, len(g))
+         for t := range g {
+            w[k][t] = g[t][i]
+         }
+      }
+      if mean, variance, ok := weighted_moments(observations, w, e.Dim(), e.MinVar); ok {
+         e.Mean[i], e.Var[i] = mean, variance
+      }
+   }
+}
+
+// Mixture of normal distributions with diagonal covariance per state.
+type GMMEmission struct {
+   Weight [][]float64   // [state][component]
+   Mean   [][][]float64 // [state][component][dimension]
+   Var    [][][]float64 // [state][component][dimension]
+   MinVar float64
+}
+
+func NewGMMEmission (weight [][]float64, mean, variance [][][]float64) *GMMEmission {
+   e := new(GMMEmission)
+   e.Weight = weight
+   e.Mean = mean
+   e.Var = variance
+   e.MinVar = 1e-6
+   return e
+}
+
+func (e *GMMEmission) N () int {
+   return len(e.Weight)
+}
+
+func (e *GMMEmission) Dim () int {
+   return len(e.Mean[0][0])
+}
+
+// ln(w_ic * N_ic(o)) of every component c of state i
+func (e *GMMEmission) component_log_likelihood (o []float64, i int) []float64 {
+   r := make([]float64, len(e.Weight[i]))
+   for c, w := range e.Weight[i] {
+      r[c] = math.Log(w) + diagonal_gaussian_log_pdf(o, e.Mean[i][c], e.Var[i][c])
+   }
+   return r
+}
+
+func (e *GMMEmission) LogLikelihood (observation [][]float64) [][]float64 {
+   r := make([][]float64, len(observation))
+   for t, o := range observation {
+      r[t] = make([]float64, e.N())
+      for i := range r[t] {
+         r[t][i] = LogSumExp(e.component_log_likelihood(o, i))
+      }
+   }
+   return r
+}
+
+func (e *GMMEmission) Reestimate (observations [][][]float64, gamma [][][]float64) {
+   for i := 0; i < e.N(); i++ {
+      components := len(e.Weight[i])
+      // w[c][k][t]: posterior of state i and component c at step t
+      w := make([][][]float64, components)
+      for c := range w {
+         w[c] = make([][]float64, len(gamma))
+      }
+      total := 0.0
+      for k, g := range gamma {
+         for c := range w {
+            w[c][k] = make([]float64, len(g))
+         }
+         for t := range g {
+            if g[t][i] == 0 {
+               continue
+            }
+            terms := e.component_log_likelihood(observations[k][t], i)
+            norm := LogSumExp(terms)
+            for c := range w {
+               w[c][k][t] = g[t][i] * math.Exp(terms[c] - norm)
+            }
+            total += g[t][i]
+         }
+      }
+      if total == 0 {
+         continue
+      }
+      for c := range w {
+         mean, variance, ok := weighted_moments(observations, w[c], e.Dim(), e.MinVar)
+         if !ok {
+            e.Weight[i][c] = 0
+            continue
+         }
+         sum := 0.0
+         for k := range w[c] {
+            for _, x := range w[c][k] {
+               sum += x
+            }
+         }
+         e.Weight[i][c] = sum / total
+         e.Mean[i][c], e.Var[i][c] = mean, variance
+      }
+   }
+}
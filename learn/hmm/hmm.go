@@ -25,52 +25,198 @@ type HiddenMarkovModel interface {
    Scale ()                    HiddenMarkovModel
 }
 
+// Transition part of a hidden Markov model; every HiddenMarkovModel is one.
+// The algorithms run on a MarkovChain and an emission matrix with one row per
+// time step, so that any emission model (see Emission) can be plugged in.
+type MarkovChain interface {
+   N  ()         int
+   A  (i, j int) float64
+   Pi (i int)    float64
+}
+
+// A chain where most transitions are impossible lists the possible ones, so
+// that the algorithms visit only those instead of all N() x N() pairs.
+type sparse_chain interface {
+   MarkovChain
+   predecessors (j int) []int // every i with A(i, j) that may be nonzero
+   successors   (i int) []int // every j with A(i, j) that may be nonzero
+}
+
+// predecessor and successor lists of hmm; every state of a dense chain
+func chain_links (hmm MarkovChain) (from, to func (int) []int) {
+   if s, ok := hmm.(sparse_chain); ok {
+      return s.predecessors, s.successors
+   }
+   all := make([]int, hmm.N())
+   for i := range all {
+      all[i] = i
+   }
+   every := func (int) []int { return all }
+   return every, every
+}
+
+// lk[t][i] = B(i, observation[t])
+func discrete_likelihood (hmm HiddenMarkovModel, observation []int) [][]float64 {
+   lk := make([][]float64, len(observation))
+   for t, o := range observation {
+      lk[t] = make([]float64, hmm.N())
+      for i := range lk[t] {
+         lk[t][i] = hmm.B(i, o)
+      }
+   }
+   return lk
+}
+
+// ln of discrete_likelihood
+func discrete_log_likelihood (hmm HiddenMarkovModel, observation []int) [][]float64 {
+   lk := discrete_likelihood(hmm, observation)
+   for _, row := range lk {
+      for i := range row {
+         row[i] = math.Log(row[i])
+      }
+   }
+   return lk
+}
+
+// Most likely state path and its log-probability ln P(observation, state),
+// computed in log space so that any sequence length works; zero
+// probabilities are -Inf. If every path is impossible, lnP is -Inf and state
+// is still a valid (arbitrary) path.
 func ViterbiCalculator (hmm HiddenMarkovModel, observation []int) (lnP float64, state []int) {
-   obn   := len(observation)
+   return viterbi(hmm, discrete_log_likelihood(hmm, observation))
+}
+
+// Viterbi over emission[t][i] = ln p(o_t | q_t = i)
+func viterbi (hmm MarkovChain, emission [][]float64) (lnP float64, state []int) {
+   obn   := len(emission)
    stn   := hmm.N()
+   state = make([]int, obn)
+   if obn == 0 {
+      return
+   }
    delta := make([][]float64, obn)
    psy   := make([][]int, obn)
    for i := 0; i < obn; i++ {
       delta[i] = make([]float64, stn)
       psy[i]   = make([]int, stn)
    }
-   state = make([]int, obn)
    for i := 0; i < stn; i++ {
-      delta[0][i] = - math.Log(hmm.Pi(i)) - math.Log(hmm.B(i, observation[0]))
-      psy[0][i]   = 0
+      delta[0][i] = math.Log(hmm.Pi(i)) + emission[0][i]
    }
 
-   tmp_delta := 0.0
-   min_delta := 0.0
+   predecessors, _ := chain_links(hmm)
    for t := 1; t < obn; t++ {
-      for from := 0; from < stn; from++ {
-         // step (hmm, observation[t], t, from)
-         min_delta = delta[t-1][0] - math.Log(hmm.A(0, from))
-         min_psy   := 0
-         for to := 1; to < stn; to++ {
-            tmp_delta = delta[t-1][to] - math.Log(hmm.A(to, from))
-            if tmp_delta < min_delta {
-               min_delta = tmp_delta
-               min_psy   = to
+      for to := 0; to < stn; to++ {
+         max_delta := math.Inf(-1)
+         max_psy   := 0
+         for _, from := range predecessors(to) {
+            tmp_delta := delta[t-1][from] + math.Log(hmm.A(from, to))
+            if tmp_delta > max_delta {
+               max_delta = tmp_delta
+               max_psy   = from
             }
          }
-         delta[t][from] = min_delta - math.Log(hmm.B(from, observation[t]))
-         psy[t][from]   = min_psy
+         delta[t][to] = max_delta + emission[t][to]
+         psy[t][to]   = max_psy
       }
    }
-   // last (hmm, observation[obn-1])
-   lnP = delta[stn-1][0]
+
+   lnP = delta[obn-1][0]
    for end := 1; end < stn; end++ {
-      tmp_delta = delta[stn-1][end]
-      if tmp_delta < lnP {
-         lnP = tmp_delta
-         state[stn-1] = end
+      if delta[obn-1][end] > lnP {
+         lnP = delta[obn-1][end]
+         state[obn-1] = end
       }
    }
-   for t := stn - 2; t >= 0; t-- {
+   for t := obn - 2; t >= 0; t-- {
       state[t] = psy[t+1][state[t+1]]
    }
-   lnP = -lnP
+   return
+}
+
+// one of the k best partial paths ending in a state at some time step
+type viterbi_entry struct {
+   lnP  float64
+   from int // state at the previous time step
+   rank int // rank of the partial path it extends in that state
+}
+
+// insert e into list kept sorted by decreasing lnP with at most k entries
+func viterbi_insert (list []viterbi_entry, e viterbi_entry, k int) []viterbi_entry {
+   if math.IsInf(e.lnP, -1) || (len(list) == k && e.lnP <= list[k-1].lnP) {
+      return list
+   }
+   i := len(list)
+   if i < k {
+      list = append(list, e)
+   } else {
+      i = k - 1
+   }
+   for ; i > 0 && list[i-1].lnP < e.lnP; i-- {
+      list[i] = list[i-1]
+   }
+   list[i] = e
+   return list
+}
+
+// List Viterbi: up to k most likely state paths with their log-probabilities,
+// best first. Impossible paths are never returned, so fewer than k paths come
+// back when fewer are possible. The first path is the one of
+// ViterbiCalculator, up to ties.
+func ViterbiNBestCalculator (hmm HiddenMarkovModel, observation []int, k int) (lnP []float64, states [][]int) {
+   return viterbi_nbest(hmm, discrete_log_likelihood(hmm, observation), k)
+}
+
+func viterbi_nbest (hmm MarkovChain, emission [][]float64, k int) (lnP []float64, states [][]int) {
+   obn := len(emission)
+   stn := hmm.N()
+   lnP    = make([]float64, 0, k)
+   states = make([][]int, 0, k)
+   if obn == 0 || k <= 0 {
+      return
+   }
+   // best[t][i]: the k best partial paths over 0..t that end in state i
+   best := make([][][]viterbi_entry, obn)
+   for t := 0; t < obn; t++ {
+      best[t] = make([][]viterbi_entry, stn)
+   }
+   for i := 0; i < stn; i++ {
+      e := viterbi_entry{math.Log(hmm.Pi(i)) + emission[0][i], -1, -1}
+      best[0][i] = viterbi_insert(make([]viterbi_entry, 0, 1), e, k)
+   }
+   predecessors, _ := chain_links(hmm)
+   for t := 1; t < obn; t++ {
+      for to := 0; to < stn; to++ {
+         list := make([]viterbi_entry, 0, k)
+         b := emission[t][to]
+         for _, from := range predecessors(to) {
+            a := math.Log(hmm.A(from, to))
+            for rank, prev := range best[t-1][from] {
+               list = viterbi_insert(list, viterbi_entry{prev.lnP + a + b, from, rank}, k)
+            }
+         }
+         best[t][to] = list
+      }
+   }
+
+   ends := make([]viterbi_entry, 0, k)
+   for i := 0; i < stn; i++ {
+      for rank, e := range best[obn-1][i] {
+         // reuse viterbi_entry: from holds the final state here
+         ends = viterbi_insert(ends, viterbi_entry{e.lnP, i, rank}, k)
+      }
+   }
+   for _, end := range ends {
+      state := make([]int, obn)
+      i, rank := end.from, end.rank
+      for t := obn - 1; t >= 0; t-- {
+         state[t] = i
+         e := best[t][i][rank]
+         i, rank = e.from, e.rank
+      }
+      lnP = append(lnP, end.lnP)
+      states = append(states, state)
+   }
    return
 }
 
@@ -133,3 +279,191 @@ func BackwardCalculator(hmm HiddenMarkovModel, observation []int) (p float64, ba
    }
    return
 }
+
+// Scaled forward (Rabiner): forward[t][i] = P(q_t = i | o_0..o_t), i.e. every
+// row is normalized to sum 1, and scale[t] = P(o_t | o_0..o_t-1) is the
+// normalizer of step t; lnP = sum(ln(scale[t])). Safe for long sequences.
+// When the observation is impossible, lnP = -Inf and the rows from that step
+// on are left zero.
+func ScaledForwardCalculator (hmm HiddenMarkovModel, observation []int) (lnP float64, forward [][]float64, scale []float64) {
+   return scaled_forward(hmm, discrete_likelihood(hmm, observation))
+}
+
+// Scaled forward over lk[t][i] = p(o_t | q_t = i)
+func scaled_forward (hmm MarkovChain, lk [][]float64) (lnP float64, forward [][]float64, scale []float64) {
+   obn := len(lk)
+   stn := hmm.N()
+   forward = make([][]float64, obn)
+   for i := 0; i < obn; i++ {
+      forward[i] = make([]float64, stn)
+   }
+   scale = make([]float64, obn)
+   if obn == 0 {
+      return
+   }
+
+   for i := 0; i < stn; i++ {
+      forward[0][i] = hmm.Pi(i) * lk[0][i]
+   }
+   predecessors, _ := chain_links(hmm)
+   for t := 0; t < obn; t++ {
+      if t > 0 {
+         for to := 0; to < stn; to++ {
+            sum := 0.0
+            for _, from := range predecessors(to) {
+               sum += forward[t-1][from] * hmm.A(from, to)
+            }
+            forward[t][to] = sum * lk[t][to]
+         }
+      }
+      for i := 0; i < stn; i++ {
+         scale[t] += forward[t][i]
+      }
+      if scale[t] == 0 {
+         lnP = math.Inf(-1)
+         return
+      }
+      for i := 0; i < stn; i++ {
+         forward[t][i] /= scale[t]
+      }
+      lnP += math.Log(scale[t])
+   }
+   return
+}
+
+// Scaled backward with the coefficients of ScaledForwardCalculator, so that
+// forward[t][i] * backward[t][i] = P(q_t = i | O). scale may be nil, then it
+// is computed by ScaledForwardCalculator.
+func ScaledBackwardCalculator (hmm HiddenMarkovModel, observation []int, scale []float64) (lnP float64, backward [][]float64) {
+   return scaled_backward(hmm, discrete_likelihood(hmm, observation), scale)
+}
+
+func scaled_backward (hmm MarkovChain, lk [][]float64, scale []float64) (lnP float64, backward [][]float64) {
+   obn := len(lk)
+   stn := hmm.N()
+   if scale == nil {
+      _, _, scale = scaled_forward(hmm, lk)
+   }
+   backward = make([][]float64, obn)
+   for i := 0; i < obn; i++ {
+      backward[i] = make([]float64, stn)
+   }
+   if obn == 0 {
+      return
+   }
+   for t := 0; t < obn; t++ {
+      if scale[t] == 0 {
+         lnP = math.Inf(-1)
+         return
+      }
+   }
+
+   for i := 0; i < stn; i++ {
+      backward[obn-1][i] = 1
+   }
+   _, successors := chain_links(hmm)
+   for t := obn - 2; t >= 0; t-- {
+      for from := 0; from < stn; from++ {
+         sum := 0.0
+         for _, to := range successors(from) {
+            sum += backward[t+1][to] * hmm.A(from, to) * lk[t+1][to]
+         }
+         backward[t][from] = sum / scale[t+1]
+      }
+      lnP += math.Log(scale[t+1])
+   }
+
+   p := 0.0
+   for i := 0; i < stn; i++ {
+      p += hmm.Pi(i) * lk[0][i] * backward[0][i]
+   }
+   lnP += math.Log(p)
+   return
+}
+
+// ln(sum(exp(x))) without overflow; -Inf for an empty or all -Inf x.
+func LogSumExp (x []float64) float64 {
+   max := math.Inf(-1)
+   for _, v := range x {
+      if v > max {
+         max = v
+      }
+   }
+   if math.IsInf(max, -1) {
+      return max
+   }
+   sum := 0.0
+   for _, v := range x {
+      sum += math.Exp(v - max)
+   }
+   return max + math.Log(sum)
+}
+
+// Forward in log space: forward[t][i] = ln(alpha_t(i)); zero probabilities
+// are -Inf.
+func LogForwardCalculator (hmm HiddenMarkovModel, observation []int) (lnP float64, forward [][]float64) {
+   return log_forward(hmm, discrete_log_likelihood(hmm, observation))
+}
+
+func log_forward (hmm MarkovChain, emission [][]float64) (lnP float64, forward [][]float64) {
+   obn := len(emission)
+   stn := hmm.N()
+   forward = make([][]float64, obn)
+   for i := 0; i < obn; i++ {
+      forward[i] = make([]float64, stn)
+   }
+   if obn == 0 {
+      return
+   }
+
+   terms := make([]float64, stn)
+   for i := 0; i < stn; i++ {
+      forward[0][i] = math.Log(hmm.Pi(i)) + emission[0][i]
+   }
+   predecessors, _ := chain_links(hmm)
+   for t := 1; t < obn; t++ {
+      for to := 0; to < stn; to++ {
+         from := predecessors(to)
+         for r, i := range from {
+            terms[r] = forward[t-1][i] + math.Log(hmm.A(i, to))
+         }
+         forward[t][to] = LogSumExp(terms[:len(from)]) + emission[t][to]
+      }
+   }
+   lnP = LogSumExp(forward[obn-1])
+   return
+}
+
+// Backward in log space: backward[t][i] = ln(beta_t(i)).
+func LogBackwardCalculator (hmm HiddenMarkovModel, observation []int) (lnP float64, backward [][]float64) {
+   return log_backward(hmm, discrete_log_likelihood(hmm, observation))
+}
+
+func log_backward (hmm MarkovChain, emission [][]float64) (lnP float64, backward [][]float64) {
+   obn := len(emission)
+   stn := hmm.N()
+   backward = make([][]float64, obn)
+   for i := 0; i < obn; i++ {
+      backward[i] = make([]float64, stn)
+   }
+   if obn == 0 {
+      return
+   }
+
+   terms := make([]float64, stn)
+   _, successors := chain_links(hmm)
+   for t := obn - 2; t >= 0; t-- {
+      for from := 0; from < stn; from++ {
+         to := successors(from)
+         for r, j := range to {
+            terms[r] = backward[t+1][j] + math.Log(hmm.A(from, j)) + emission[t+1][j]
+         }
+         backward[t][from] = LogSumExp(terms[:len(to)])
+      }
+   }
+   for i := 0; i < stn; i++ {
+      terms[i] = math.Log(hmm.Pi(i)) + emission[0][i] + backward[0][i]
+   }
+   lnP = LogSumExp(terms)
+   return
+}
@@ -2,7 +2,15 @@ package hmm
 
 import (
    "testing"
+   "testing/quick"
    "fmt"
+   "math"
+   "math/rand"
+   "reflect"
+   "sort"
+   "encoding/json"
+   "bytes"
+   "strings"
 )
 
 const epsilon = 1e-9
@@ -49,13 +57,702 @@ func TestHmmForwardAndBackward (t *testing.T) {
    }
 }
 
+// observations of the test model, drawn with a fixed seed
+func initTestObservation (m HiddenMarkovModel, length int) []int {
+   _, observation := Sample(m, length, rand.New(rand.NewSource(1)))
+   return observation
+}
+
+func TestHmmScaledAndLogForwardBackward (t *testing.T) {
+   m := initTestData()
+   short := []int{0, 1, 0}
+   p, _ := ForwardCalculator(m, short)
+   for _, lnP := range []float64{
+      func () float64 { lnP, _, _ := ScaledForwardCalculator(m, short); return lnP }(),
+      func () float64 { lnP, _ := ScaledBackwardCalculator(m, short, nil); return lnP }(),
+      func () float64 { lnP, _ := LogForwardCalculator(m, short); return lnP }(),
+      func () float64 { lnP, _ := LogBackwardCalculator(m, short); return lnP }(),
+   } {
+      if math.Abs(lnP - math.Log(p)) > epsilon {
+         t.Errorf("%v != ln(%v)", lnP, p)
+      }
+   }
+}
+
+func TestHmmForwardBackwardLongSequence (t *testing.T) {
+   m := initTestData()
+   observation := initTestObservation(m, 10000)
+   if p, _ := ForwardCalculator(m, observation); p != 0 {
+      t.Log("raw forward does not underflow:", p)
+   }
+
+   lnP, forward, scale := ScaledForwardCalculator(m, observation)
+   lnPb, backward := ScaledBackwardCalculator(m, observation, scale)
+   lnPlog, log_forward := LogForwardCalculator(m, observation)
+   lnPlogb, log_backward := LogBackwardCalculator(m, observation)
+   fmt.Println(lnP, lnPb, lnPlog, lnPlogb)
+   if math.IsInf(lnP, 0) || math.IsNaN(lnP) || lnP > -1000 {
+      t.Fatal("log-likelihood", lnP)
+   }
+   for _, v := range []float64{lnPb, lnPlog, lnPlogb} {
+      if math.Abs(v - lnP) > 1e-9 * math.Abs(lnP) {
+         t.Errorf("%v != %v", v, lnP)
+      }
+   }
+   for _, step := range []int{0, 1, 5000, 9999} {
+      sum := 0.0
+      log_terms := make([]float64, m.N())
+      for i := 0; i < m.N(); i++ {
+         gamma := forward[step][i] * backward[step][i]
+         log_gamma := math.Exp(log_forward[step][i] + log_backward[step][i] - lnPlog)
+         if math.Abs(gamma - log_gamma) > 1e-9 {
+            t.Errorf("gamma[%d][%d]: %v != %v", step, i, gamma, log_gamma)
+         }
+         sum += gamma
+         log_terms[i] = log_forward[step][i] + log_backward[step][i]
+      }
+      if math.Abs(sum - 1) > 1e-9 || math.Abs(LogSumExp(log_terms) - lnPlog) > 1e-9 * math.Abs(lnP) {
+         t.Errorf("step %d: posterior sums to %v", step, sum)
+      }
+   }
+}
+
+func TestHmmScaledForwardImpossible (t *testing.T) {
+   m := MakeBasicHMM(1, 2)
+   m.FillA([][]float64{{1}})
+   m.FillB([][]float64{{1, 0}})
+   m.FillPi([]float64{1})
+   lnP, _, _ := ScaledForwardCalculator(m, []int{0, 1, 0})
+   lnPlog, _ := LogForwardCalculator(m, []int{0, 1, 0})
+   if !math.IsInf(lnP, -1) || !math.IsInf(lnPlog, -1) {
+      t.Fail()
+   }
+}
+
+// One Baum-Welch re-estimation by enumerating every state path.
+func bruteForceReestimate (m HiddenMarkovModel, observations [][]int) *BasicHMM {
+   n := m.N()
+   r := MakeBasicHMM(n, m.M())
+   a_den := make([]float64, n)
+   b_den := make([]float64, n)
+   for _, observation := range observations {
+      obn := len(observation)
+      paths := 1
+      for t := 0; t < obn; t++ {
+         paths *= n
+      }
+      total := 0.0
+      weights := make([]float64, paths)
+      states := make([][]int, paths)
+      for k := 0; k < paths; k++ {
+         state := make([]int, obn)
+         x := k
+         for t := 0; t < obn; t++ {
+            state[t] = x % n
+            x /= n
+         }
+         p := m.Pi(state[0]) * m.B(state[0], observation[0])
+         for t := 1; t < obn; t++ {
+            p *= m.A(state[t-1], state[t]) * m.B(state[t], observation[t])
+         }
+         states[k] = state
+         weights[k] = p
+         total += p
+      }
+      for k, state := range states {
+         w := weights[k] / total
+         r.SetPi(state[0], r.Pi(state[0]) + w / float64(len(observations)))
+         for t := 0; t < obn; t++ {
+            r.SetB(state[t], observation[t], r.B(state[t], observation[t]) + w)
+            b_den[state[t]] += w
+            if t < obn - 1 {
+               r.SetA(state[t], state[t+1], r.A(state[t], state[t+1]) + w)
+               a_den[state[t]] += w
+            }
+         }
+      }
+   }
+   for i := 0; i < n; i++ {
+      for j := 0; j < n; j++ {
+         r.SetA(i, j, r.A(i, j) / a_den[i])
+      }
+      for k := 0; k < m.M(); k++ {
+         r.SetB(i, k, r.B(i, k) / b_den[i])
+      }
+   }
+   return r
+}
+
+func assertSameHMM (t *testing.T, a, b HiddenMarkovModel, tolerance float64) {
+   for i := 0; i < a.N(); i++ {
+      if math.Abs(a.Pi(i) - b.Pi(i)) > tolerance {
+         t.Errorf("Pi(%d): %v != %v", i, a.Pi(i), b.Pi(i))
+      }
+      for j := 0; j < a.N(); j++ {
+         if math.Abs(a.A(i, j) - b.A(i, j)) > tolerance {
+            t.Errorf("A(%d, %d): %v != %v", i, j, a.A(i, j), b.A(i, j))
+         }
+      }
+      for k := 0; k < a.M(); k++ {
+         if math.Abs(a.B(i, k) - b.B(i, k)) > tolerance {
+            t.Errorf("B(%d, %d): %v != %v", i, k, a.B(i, k), b.B(i, k))
+         }
+      }
+   }
+}
+
+func TestBaumWelchReestimation (t *testing.T) {
+   observations := [][]int{{0, 1, 0}, {1, 1, 0, 1}, {0}}
+   m := initTestData()
+   expect := bruteForceReestimate(m, observations)
+   trajectory := BaumWelchTrainer(m, observations, math.Inf(-1), 1)
+   assertSameHMM(t, m, expect, epsilon)
+
+   lnP := 0.0
+   for _, observation := range observations {
+      lnp, _ := LogForwardCalculator(initTestData(), observation)
+      lnP += lnp
+   }
+   if len(trajectory) != 2 || math.Abs(trajectory[0] - lnP) > epsilon || trajectory[1] < trajectory[0] {
+      t.Error(trajectory, lnP)
+   }
+}
+
+func TestBaumWelchConvergence (t *testing.T) {
+   truth := initTestData()
+   // independent sequences from one generator
+   rng := rand.New(rand.NewSource(3))
+   observations := make([][]int, 4)
+   for i := range observations {
+      _, observations[i] = Sample(truth, 2000, rng)
+   }
+   m := MakeBasicHMM(3, 2)
+   m.FillA([][]float64{{0.4, 0.3, 0.3}, {0.3, 0.4, 0.3}, {0.3, 0.3, 0.4}})
+   m.FillB([][]float64{{0.6, 0.4}, {0.5, 0.5}, {0.4, 0.6}})
+   m.FillPi([]float64{0.3, 0.3, 0.4})
+   trajectory := BaumWelchTrainer(m, observations, 1e-3, 200)
+   if len(trajectory) > 201 || len(trajectory) < 3 {
+      t.Fatal(len(trajectory))
+   }
+   for k := 1; k < len(trajectory); k++ {
+      if math.IsNaN(trajectory[k]) || trajectory[k] < trajectory[k-1] - 1e-6 {
+         t.Fatalf("likelihood drops at %d: %v", k, trajectory)
+      }
+   }
+   if last := len(trajectory) - 1; len(trajectory) < 201 && trajectory[last - 1] - trajectory[last - 2] >= 1e-3 {
+      t.Error("stopped before convergence")
+   }
+}
+
+// ln P(observation, state) of every state path, best first.
+func bruteForcePaths (m HiddenMarkovModel, observation []int) ([]float64, [][]int) {
+   n := m.N()
+   obn := len(observation)
+   paths := 1
+   for t := 0; t < obn; t++ {
+      paths *= n
+   }
+   lnP := make([]float64, paths)
+   states := make([][]int, paths)
+   for k := 0; k < paths; k++ {
+      state := make([]int, obn)
+      x := k
+      for t := 0; t < obn; t++ {
+         state[t] = x % n
+         x /= n
+      }
+      p := math.Log(m.Pi(state[0])) + math.Log(m.B(state[0], observation[0]))
+      for t := 1; t < obn; t++ {
+         p += math.Log(m.A(state[t-1], state[t])) + math.Log(m.B(state[t], observation[t]))
+      }
+      lnP[k] = p
+      states[k] = state
+   }
+   sort.Stable(byLnP{lnP, states})
+   return lnP, states
+}
+
+type byLnP struct {
+   lnP    []float64
+   states [][]int
+}
+
+func (s byLnP) Len () int { return len(s.lnP) }
+func (s byLnP) Less (i, j int) bool { return s.lnP[i] > s.lnP[j] }
+func (s byLnP) Swap (i, j int) {
+   s.lnP[i], s.lnP[j] = s.lnP[j], s.lnP[i]
+   s.states[i], s.states[j] = s.states[j], s.states[i]
+}
+
+func pathLnP (m HiddenMarkovModel, observation, state []int) float64 {
+   p := math.Log(m.Pi(state[0])) + math.Log(m.B(state[0], observation[0]))
+   for t := 1; t < len(observation); t++ {
+      p += math.Log(m.A(state[t-1], state[t])) + math.Log(m.B(state[t], observation[t]))
+   }
+   return p
+}
+
 func TestHmmViterbi (t *testing.T) {
    m := initTestData()
    _, s := ViterbiCalculator(m, []int{0, 1, 0})
-   fmt.Println(s)
    if s[0] != 2 || s[1] != 2 || s[2] != 2 {
       t.Fail()
    }
+
+   for _, observation := range [][]int{{1}, {0, 1}, {0, 1, 0, 0, 1}, {1, 1, 0, 1, 0, 0, 1}} {
+      expect, _ := bruteForcePaths(m, observation)
+      lnP, state := ViterbiCalculator(m, observation)
+      if len(state) != len(observation) || math.Abs(lnP - expect[0]) > epsilon || math.Abs(pathLnP(m, observation, state) - lnP) > epsilon {
+         t.Error(observation, lnP, state, expect[0])
+      }
+   }
+
+   // much longer than N: must not underflow
+   observation := initTestObservation(m, 5000)
+   lnP, state := ViterbiCalculator(m, observation)
+   if math.IsInf(lnP, 0) || math.IsNaN(lnP) || math.Abs(pathLnP(m, observation, state) - lnP) > 1e-6 {
+      t.Error(lnP)
+   }
+}
+
+func TestHmmViterbiImpossible (t *testing.T) {
+   m := MakeBasicHMM(2, 2)
+   m.FillA([][]float64{{0, 1}, {0, 1}})
+   m.FillB([][]float64{{1, 0}, {0, 1}})
+   m.FillPi([]float64{1, 0})
+   lnP, state := ViterbiCalculator(m, []int{0, 1, 1})
+   if math.Abs(lnP) > epsilon || state[0] != 0 || state[1] != 1 || state[2] != 1 {
+      t.Error(lnP, state)
+   }
+   lnP, _ = ViterbiCalculator(m, []int{0, 0})
+   if !math.IsInf(lnP, -1) {
+      t.Error(lnP)
+   }
+   lnPs, states := ViterbiNBestCalculator(m, []int{0, 0}, 3)
+   if len(lnPs) != 0 || len(states) != 0 {
+      t.Error(lnPs, states)
+   }
+}
+
+func TestHmmViterbiNBest (t *testing.T) {
+   m := initTestData()
+   observation := []int{0, 1, 1, 0, 1}
+   expect, _ := bruteForcePaths(m, observation)
+   for _, k := range []int{1, 4, 10, len(expect), len(expect) + 5} {
+      lnP, states := ViterbiNBestCalculator(m, observation, k)
+      want := k
+      if want > len(expect) {
+         want = len(expect)
+      }
+      if len(lnP) != want || len(states) != want {
+         t.Fatal(k, len(lnP), len(states))
+      }
+      seen := make(map[string]bool)
+      for r := 0; r < want; r++ {
+         key := fmt.Sprint(states[r])
+         if seen[key] {
+            t.Error("duplicate path", key)
+         }
+         seen[key] = true
+         if math.Abs(lnP[r] - expect[r]) > epsilon || math.Abs(pathLnP(m, observation, states[r]) - lnP[r]) > epsilon {
+            t.Error(k, r, lnP[r], expect[r], states[r])
+         }
+      }
+   }
+   best, state := ViterbiCalculator(m, observation)
+   lnP, states := ViterbiNBestCalculator(m, observation, 3)
+   if math.Abs(best - lnP[0]) > epsilon || fmt.Sprint(state) != fmt.Sprint(states[0]) {
+      t.Error(best, state, lnP[0], states[0])
+   }
+}
+
+func TestHmmPosterior (t *testing.T) {
+   m := initTestData()
+   observation := []int{0, 1, 1, 0, 1}
+   lnPs, states := bruteForcePaths(m, observation)
+   total := 0.0
+   for _, lnp := range lnPs {
+      total += math.Exp(lnp)
+   }
+   expect_gamma := make([][]float64, len(observation))
+   expect_xi := make([][][]float64, len(observation) - 1)
+   for t := range observation {
+      expect_gamma[t] = make([]float64, m.N())
+      if t < len(observation) - 1 {
+         expect_xi[t] = make([][]float64, m.N())
+         for i := range expect_xi[t] {
+            expect_xi[t][i] = make([]float64, m.N())
+         }
+      }
+   }
+   for k, state := range states {
+      w := math.Exp(lnPs[k]) / total
+      for t, i := range state {
+         expect_gamma[t][i] += w
+         if t < len(state) - 1 {
+            expect_xi[t][i][state[t+1]] += w
+         }
+      }
+   }
+
+   lnP, gamma := StatePosteriorCalculator(m, observation)
+   if math.Abs(lnP - math.Log(total)) > epsilon {
+      t.Error(lnP, math.Log(total))
+   }
+   _, xi := TransitionPosteriorCalculator(m, observation)
+   if len(gamma) != len(observation) || len(xi) != len(observation) - 1 {
+      t.Fatal(len(gamma), len(xi))
+   }
+   for tt := range gamma {
+      for i := range gamma[tt] {
+         if math.Abs(gamma[tt][i] - expect_gamma[tt][i]) > epsilon {
+            t.Error("gamma", tt, i, gamma[tt][i], expect_gamma[tt][i])
+         }
+         if tt == len(xi) {
+            continue
+         }
+         for j := range xi[tt][i] {
+            if math.Abs(xi[tt][i][j] - expect_xi[tt][i][j]) > epsilon {
+               t.Error("xi", tt, i, j, xi[tt][i][j], expect_xi[tt][i][j])
+            }
+         }
+      }
+   }
+
+   state, confidence := PosteriorDecoder(m, observation)
+   for tt, i := range state {
+      for j := range gamma[tt] {
+         if gamma[tt][j] > gamma[tt][i] {
+            t.Error("not the most likely state", tt, state)
+         }
+      }
+      if confidence[tt] != gamma[tt][i] {
+         t.Error(tt, confidence[tt], gamma[tt][i])
+      }
+   }
+
+   // long sequences must not underflow
+   _, gamma = StatePosteriorCalculator(m, initTestObservation(m, 10000))
+   for tt := range gamma {
+      sum := 0.0
+      for _, p := range gamma[tt] {
+         sum += p
+      }
+      if math.Abs(sum - 1) > 1e-9 {
+         t.Fatal(tt, gamma[tt])
+      }
+   }
+}
+
+func TestHmmPosteriorImpossible (t *testing.T) {
+   m := MakeBasicHMM(2, 2)
+   m.FillA([][]float64{{0, 1}, {0, 1}})
+   m.FillB([][]float64{{1, 0}, {0, 1}})
+   m.FillPi([]float64{1, 0})
+   lnP, gamma := StatePosteriorCalculator(m, []int{0, 0})
+   _, xi := TransitionPosteriorCalculator(m, []int{0, 0})
+   if !math.IsInf(lnP, -1) || gamma[0][0] != 0 || gamma[1][0] != 0 || xi[0][0][1] != 0 {
+      t.Error(lnP, gamma, xi)
+   }
+   _, confidence := PosteriorDecoder(m, []int{0, 0})
+   if confidence[0] != 0 || confidence[1] != 0 {
+      t.Error(confidence)
+   }
+}
+
+// Random model for property tests: every state prefers to stay and emits
+// mostly its own symbol, so that the parameters are identifiable from data.
+type quickHMM struct {
+   *BasicHMM
+   Seed int64
+}
+
+func (quickHMM) Generate (r *rand.Rand, size int) reflect.Value {
+   n := 2 + r.Intn(2)
+   m := n + r.Intn(2)
+   row := func (k, peak int) []float64 {
+      v := make([]float64, k)
+      sum := 0.0
+      for i := range v {
+         v[i] = 0.1 + r.Float64()
+         if i == peak {
+            v[i] += 2
+         }
+         sum += v[i]
+      }
+      for i := range v {
+         v[i] /= sum
+      }
+      return v
+   }
+   h := MakeBasicHMM(n, m)
+   a := make([][]float64, n)
+   b := make([][]float64, n)
+   for i := 0; i < n; i++ {
+      a[i] = row(n, i)
+      b[i] = row(m, i)
+   }
+   h.FillA(a)
+   h.FillB(b)
+   h.FillPi(row(n, -1))
+   return reflect.ValueOf(quickHMM{h, r.Int63()})
+}
+
+func maxParamDiff (a, b HiddenMarkovModel, with_pi bool) float64 {
+   d := 0.0
+   for i := 0; i < a.N(); i++ {
+      if with_pi {
+         d = math.Max(d, math.Abs(a.Pi(i) - b.Pi(i)))
+      }
+      for j := 0; j < a.N(); j++ {
+         d = math.Max(d, math.Abs(a.A(i, j) - b.A(i, j)))
+      }
+      for k := 0; k < a.M(); k++ {
+         d = math.Max(d, math.Abs(a.B(i, k) - b.B(i, k)))
+      }
+   }
+   return d
+}
+
+// a fresh generator per test, so that every test sees the same models alone
+// or in the whole suite
+func quickConfig (seed int64) *quick.Config {
+   return &quick.Config{MaxCount: 20, Rand: rand.New(rand.NewSource(seed))}
+}
+
+func TestSample (t *testing.T) {
+   m := initTestData()
+   s1, o1 := Sample(m, 100, rand.New(rand.NewSource(7)))
+   s2, o2 := Sample(m, 100, rand.New(rand.NewSource(7)))
+   if !reflect.DeepEqual(s1, s2) || !reflect.DeepEqual(o1, o2) {
+      t.Error("same seed, different samples")
+   }
+   if s, o := Sample(m, 0, nil); len(s) != 0 || len(o) != 0 {
+      t.Error(s, o)
+   }
+
+   // a zero probability is never drawn
+   z := MakeBasicHMM(2, 2)
+   z.FillA([][]float64{{0, 1}, {1, 0}})
+   z.FillB([][]float64{{1, 0}, {0, 1}})
+   z.FillPi([]float64{0, 1})
+   state, observation := Sample(z, 50, rand.New(rand.NewSource(1)))
+   for i := range state {
+      if state[i] != (i + 1) % 2 || observation[i] != state[i] {
+         t.Fatal(state, observation)
+      }
+   }
+}
+
+func TestSampleRecoveredByBasicLearner (t *testing.T) {
+   property := func (q quickHMM) bool {
+      rng := rand.New(rand.NewSource(q.Seed))
+      learned := MakeBasicHMM(q.N(), q.M())
+      for k := 0; k < 200; k++ {
+         state, observation := Sample(q, 100, rng)
+         learned = BasicLearner(learned, observation, state, 1)
+      }
+      scaled := learned.Scale()
+      d := maxParamDiff(scaled, q, false)
+      pi := 0.0
+      for i := 0; i < q.N(); i++ {
+         pi = math.Max(pi, math.Abs(scaled.Pi(i) - q.Pi(i)))
+      }
+      if d > 0.05 || pi > 0.15 {
+         t.Log(d, pi, StringifyBasicHMM(q.BasicHMM))
+         return false
+      }
+      return true
+   }
+   if err := quick.Check(property, quickConfig(1)); err != nil {
+      t.Error(err)
+   }
+}
+
+func TestSampleRecoveredByBaumWelch (t *testing.T) {
+   property := func (q quickHMM) bool {
+      _, observation := Sample(q, 10000, rand.New(rand.NewSource(q.Seed)))
+      // start between the truth and the uniform model
+      start := MakeBasicHMM(q.N(), q.M())
+      for i := 0; i < q.N(); i++ {
+         start.SetPi(i, 0.5 * q.Pi(i) + 0.5 / float64(q.N()))
+         for j := 0; j < q.N(); j++ {
+            start.SetA(i, j, 0.5 * q.A(i, j) + 0.5 / float64(q.N()))
+         }
+         for k := 0; k < q.M(); k++ {
+            start.SetB(i, k, 0.5 * q.B(i, k) + 0.5 / float64(q.M()))
+         }
+      }
+      BaumWelchLeaner(false, start, observation, 100)
+      if d := maxParamDiff(start, q, false); d > 0.15 {
+         t.Log(d, StringifyBasicHMM(q.BasicHMM), StringifyBasicHMM(start))
+         return false
+      }
+      return true
+   }
+   if err := quick.Check(property, quickConfig(2)); err != nil {
+      t.Error(err)
+   }
+}
+
+// Two sticky states emitting around separate means; returns the model and
+// sequences drawn from it.
+func initTestGaussian (dim, sequences, length int) (*ContinuousHMM, [][][]float64) {
+   mean := [][]float64{make([]float64, dim), make([]float64, dim)}
+   variance := [][]float64{make([]float64, dim), make([]float64, dim)}
+   for d := 0; d < dim; d++ {
+      mean[0][d], mean[1][d] = -1, 2
+      variance[0][d], variance[1][d] = 1, 0.5
+   }
+   h := NewContinuousHMM(NewGaussianEmission(mean, variance))
+   h.Chain.FillA([][]float64{{0.9, 0.1}, {0.2, 0.8}})
+   h.Chain.FillPi([]float64{0.6, 0.4})
+
+   // B is irrelevant for the states: a single symbol
+   chain := MakeBasicHMM(2, 1)
+   chain.FillA(*h.Chain.GetA())
+   chain.FillPi(*h.Chain.GetPi())
+   chain.FillB([][]float64{{1}, {1}})
+   r := rand.New(rand.NewSource(1))
+   observations := make([][][]float64, sequences)
+   for k := range observations {
+      state, _ := Sample(chain, length, r)
+      observations[k] = make([][]float64, length)
+      for t, i := range state {
+         observations[k][t] = make([]float64, dim)
+         for d := 0; d < dim; d++ {
+            observations[k][t][d] = mean[i][d] + math.Sqrt(variance[i][d]) * r.NormFloat64()
+         }
+      }
+   }
+   return h, observations
+}
+
+func TestDiscreteEmission (t *testing.T) {
+   m := initTestData()
+   h := &ContinuousHMM{Chain: m.(*BasicHMM), Emission: &DiscreteEmission{m}}
+   observation := initTestObservation(m, 200)
+   vectors := make([][]float64, len(observation))
+   for i, o := range observation {
+      vectors[i] = []float64{float64(o)}
+   }
+   lnP, _, _ := ScaledForwardCalculator(m, observation)
+   lnPc, _, scale := ContinuousForwardCalculator(h, vectors)
+   lnPb, _ := ContinuousBackwardCalculator(h, vectors, scale)
+   if math.Abs(lnP - lnPc) > 1e-9 || math.Abs(lnP - lnPb) > 1e-9 {
+      t.Error(lnP, lnPc, lnPb)
+   }
+   lnP, state := ViterbiCalculator(m, observation)
+   lnPc, statec := ContinuousViterbiCalculator(h, vectors)
+   if math.Abs(lnP - lnPc) > 1e-9 || !reflect.DeepEqual(state, statec) {
+      t.Error(lnP, lnPc)
+   }
+}
+
+func TestGaussianEmission (t *testing.T) {
+   e := NewGaussianEmission([][]float64{{0, 1}}, [][]float64{{1, 4}})
+   lk := e.LogLikelihood([][]float64{{1, -1}})
+   expect := math.Log(math.Exp(-0.5) / math.Sqrt(2 * math.Pi)) + math.Log(math.Exp(-0.5) / math.Sqrt(8 * math.Pi))
+   if math.Abs(lk[0][0] - expect) > epsilon {
+      t.Error(lk, expect)
+   }
+
+   // one component mixtures are plain gaussians
+   h, observations := initTestGaussian(2, 1, 50)
+   g := h.Emission.(*GaussianEmission)
+   gmm := NewGMMEmission(
+      [][]float64{{1}, {1}},
+      [][][]float64{{g.Mean[0]}, {g.Mean[1]}},
+      [][][]float64{{g.Var[0]}, {g.Var[1]}},
+   )
+   a := g.LogLikelihood(observations[0])
+   b := gmm.LogLikelihood(observations[0])
+   for i := range a {
+      for j := range a[i] {
+         if math.Abs(a[i][j] - b[i][j]) > epsilon {
+            t.Fatal(i, j, a[i][j], b[i][j])
+         }
+      }
+   }
+
+   // forward against summing over every path
+   observation := observations[0][:6]
+   emission := g.LogLikelihood(observation)
+   n := 1 << uint(len(observation))
+   terms := make([]float64, n)
+   for p := 0; p < n; p++ {
+      prev := -1
+      for step := range observation {
+         i := (p >> uint(step)) & 1
+         if prev < 0 {
+            terms[p] = math.Log(h.Chain.Pi(i))
+         } else {
+            terms[p] += math.Log(h.Chain.A(prev, i))
+         }
+         terms[p] += emission[step][i]
+         prev = i
+      }
+   }
+   lnP, _, _ := ContinuousForwardCalculator(h, observation)
+   if math.Abs(lnP - LogSumExp(terms)) > 1e-9 {
+      t.Error(lnP, LogSumExp(terms))
+   }
+   lnPs, states := ContinuousViterbiNBestCalculator(h, observation, 3)
+   best, state := ContinuousViterbiCalculator(h, observation)
+   if len(lnPs) != 3 || math.Abs(lnPs[0] - best) > epsilon || !reflect.DeepEqual(states[0], state) {
+      t.Error(lnPs, best)
+   }
+
+   // densities of 400 dimensions underflow without the per-step rescaling
+   h, observations = initTestGaussian(400, 1, 100)
+   lnP, _, _ = ContinuousForwardCalculator(h, observations[0])
+   lnPb, _ := ContinuousBackwardCalculator(h, observations[0], nil)
+   if math.IsInf(lnP, 0) || math.IsNaN(lnP) || math.Abs(lnP - lnPb) > 1e-6 * math.Abs(lnP) {
+      t.Error(lnP, lnPb)
+   }
+}
+
+func TestContinuousBaumWelch (t *testing.T) {
+   truth, observations := initTestGaussian(2, 10, 300)
+   g := truth.Emission.(*GaussianEmission)
+
+   h := NewContinuousHMM(NewGaussianEmission(
+      [][]float64{{-0.5, 0}, {0.5, 1}}, [][]float64{{2, 2}, {2, 2}},
+   ))
+   trajectory := ContinuousBaumWelchTrainer(h, observations, 1e-6, 200)
+   for k := 1; k < len(trajectory); k++ {
+      if trajectory[k] < trajectory[k-1] - 1e-6 {
+         t.Fatal("likelihood drops", k, trajectory)
+      }
+   }
+   learned := h.Emission.(*GaussianEmission)
+   for i := 0; i < 2; i++ {
+      for d := 0; d < 2; d++ {
+         if math.Abs(learned.Mean[i][d] - g.Mean[i][d]) > 0.1 || math.Abs(learned.Var[i][d] - g.Var[i][d]) > 0.1 {
+            t.Error(i, d, learned.Mean[i][d], learned.Var[i][d])
+         }
+      }
+   }
+   if d := maxParamDiff(h.Chain, truth.Chain, false); d > 0.05 {
+      t.Error("A", d, *h.Chain.GetA())
+   }
+
+   gmm := NewContinuousHMM(NewGMMEmission(
+      [][]float64{{0.5, 0.5}, {0.5, 0.5}},
+      [][][]float64{{{-1, 0}, {0, -1}}, {{1, 1}, {2, 0}}},
+      [][][]float64{{{1, 1}, {1, 1}}, {{1, 1}, {1, 1}}},
+   ))
+   trajectory = ContinuousBaumWelchTrainer(gmm, observations, 1e-6, 50)
+   for k := 1; k < len(trajectory); k++ {
+      if math.IsNaN(trajectory[k]) || trajectory[k] < trajectory[k-1] - 1e-6 {
+         t.Fatal("likelihood drops", k, trajectory)
+      }
+   }
+   for i, w := range gmm.Emission.(*GMMEmission).Weight {
+      if math.Abs(w[0] + w[1] - 1) > 1e-9 {
+         t.Error(i, w)
+      }
+   }
 }
 
 func TestBasicHMMExpandBasicHMM (t *testing.T) {
@@ -101,6 +798,177 @@ func TestBasicLearner (t *testing.T) {
    }
 }
 
+func TestBasicLearnerFirstEmission (t *testing.T) {
+   m := BasicLearner(MakeBasicHMM(2, 2), []int{1, 0}, []int{1, 0}, 1.0)
+   if m.B(1, 1) != 1 || m.B(0, 1) != 0 || m.B(0, 0) != 1 || m.Pi(1) != 1 {
+      t.Error(StringifyBasicHMM(m))
+   }
+}
+
+func TestSupervisedTrainer (t *testing.T) {
+   observations := [][]int{{0, 1, 1}, {1, 0}}
+   states := [][]int{{0, 1, 1}, {1, 0}}
+   m, err := SupervisedLearner(observations, states, 0)
+   if err != nil {
+      t.Fatal(err)
+   }
+   // transitions 0->1, 1->1, 1->0; emissions 0:0 x2, 1:1 x3
+   expect := MakeBasicHMM(2, 2)
+   expect.FillA([][]float64{{0, 1}, {0.5, 0.5}})
+   expect.FillB([][]float64{{1, 0}, {0, 1}})
+   expect.FillPi([]float64{0.5, 0.5})
+   assertSameHMM(t, m, expect, epsilon)
+
+   // add-one smoothing
+   m, _ = SupervisedLearner(observations, states, 1)
+   expect.FillA([][]float64{{1.0 / 3, 2.0 / 3}, {0.5, 0.5}})
+   expect.FillB([][]float64{{0.75, 0.25}, {0.2, 0.8}})
+   expect.FillPi([]float64{0.5, 0.5})
+   assertSameHMM(t, m, expect, epsilon)
+
+   // incremental updates give the batch model, growing with new states
+   more_observations := [][]int{{2, 0}, {0, 2, 2}}
+   more_states := [][]int{{2, 2}, {0, 2, 1}}
+   s := NewSupervisedTrainer(2, 2, 0.5)
+   if err := s.AddAll(observations, states); err != nil {
+      t.Fatal(err)
+   }
+   before := s.Model()
+   for k := range more_observations {
+      if err := s.Add(more_observations[k], more_states[k]); err != nil {
+         t.Fatal(err)
+      }
+   }
+   batch, _ := SupervisedLearner(append(observations, more_observations ...), append(states, more_states ...), 0.5)
+   if before.N() != 2 || s.Model().N() != 3 || s.Model().M() != 3 {
+      t.Fatal(before.N(), s.Model().N(), s.Model().M())
+   }
+   assertSameHMM(t, s.Model(), batch, epsilon)
+
+   if err := s.Add([]int{0, 1}, []int{0}); err == nil {
+      t.Error("length mismatch accepted")
+   }
+   if _, err := SupervisedLearner([][]int{{0}}, nil, 1); err == nil {
+      t.Error("sequence count mismatch accepted")
+   }
+   if m := NewSupervisedTrainer(2, 2, 0).Model(); math.IsNaN(m.Pi(0)) || math.IsNaN(m.A(0, 0)) {
+      t.Error(StringifyBasicHMM(m))
+   }
+}
+
+func TestVocabulary (t *testing.T) {
+   v := NewVocabulary(true, "the", "dog")
+   if v.Size() != 3 || v.Word(0) != UnknownWord || v.Add("dog") != 2 || v.Add("cat") != 3 {
+      t.Fatal(v.Words())
+   }
+   indices, err := v.Encode([]string{"the", "bird", "cat"})
+   if err != nil || !reflect.DeepEqual(indices, []int{1, 0, 3}) {
+      t.Error(indices, err)
+   }
+   if words := v.Decode([]int{3, 1, 9}); !reflect.DeepEqual(words, []string{"cat", "the", ""}) {
+      t.Error(words)
+   }
+
+   strict := NewVocabulary(false, "NOUN")
+   if _, err := strict.Encode([]string{"VERB"}); err == nil {
+      t.Error("unknown word without a bucket accepted")
+   }
+
+   raw, err := json.Marshal(v)
+   if err != nil {
+      t.Fatal(err)
+   }
+   var back Vocabulary
+   if err := json.Unmarshal(raw, &back); err != nil || !reflect.DeepEqual(back.Words(), v.Words()) || !back.HasUnknown() {
+      t.Error(string(raw), err)
+   }
+   if i, _ := back.Index("cat"); i != 3 {
+      t.Error(i)
+   }
+   if err := json.Unmarshal([]byte(`{"Words":["a","a"]}`), &back); err == nil {
+      t.Error("duplicate word accepted")
+   }
+   if err := json.Unmarshal([]byte(`{"Words":["a"],"Unknown":true}`), &back); err == nil {
+      t.Error("unknown bucket not at 0 accepted")
+   }
+}
+
+func TestTagger (t *testing.T) {
+   trainer := NewTaggerTrainer(0.1)
+   corpus := [][2][]string{
+      {{"the", "dog", "barks"}, {"DET", "NOUN", "VERB"}},
+      {{"a", "cat", "sleeps"}, {"DET", "NOUN", "VERB"}},
+      {{"the", "cat", "barks"}, {"DET", "NOUN", "VERB"}},
+      {{"dogs", "sleep"}, {"NOUN", "VERB"}},
+   }
+   for _, pair := range corpus {
+      if err := trainer.Add(pair[0], pair[1]); err != nil {
+         t.Fatal(err)
+      }
+   }
+   if err := trainer.Add([]string{"the"}, nil); err == nil {
+      t.Error("length mismatch accepted")
+   }
+   tagger := trainer.Tagger()
+   tags, err := tagger.Decode([]string{"the", "dog", "sleeps"})
+   if err != nil || !reflect.DeepEqual(tags, []string{"DET", "NOUN", "VERB"}) {
+      t.Error(tags, err)
+   }
+   // an unseen word gets its tag from the context
+   tags, err = tagger.Decode([]string{"a", "platypus", "barks"})
+   if err != nil || !reflect.DeepEqual(tags, []string{"DET", "NOUN", "VERB"}) {
+      t.Error(tags, err)
+   }
+   tags, confidence, err := tagger.DecodePosterior([]string{"the", "dog"})
+   if err != nil || !reflect.DeepEqual(tags, []string{"DET", "NOUN"}) || confidence[0] < 0.5 || confidence[0] > 1 {
+      t.Error(tags, confidence, err)
+   }
+
+   // building a tagger leaves the counts of the trainer alone
+   counts := StringifyBasicHMM(trainer.Trainer.Counts)
+   trainer.Tagger()
+   if StringifyBasicHMM(trainer.Trainer.Counts) != counts {
+      t.Error("Tagger changed the counts")
+   }
+
+   // without smoothing, unknown words live on the words seen once
+   trainer.Trainer.K = 0
+   tagger = trainer.Tagger()
+   tags, err = tagger.Decode([]string{"a", "platypus", "barks"})
+   if err != nil || !reflect.DeepEqual(tags, []string{"DET", "NOUN", "VERB"}) {
+      t.Error(tags, err)
+   }
+   if tags, err = tagger.Decode([]string{"barks", "the"}); err == nil {
+      t.Error("impossible sequence decoded", tags)
+   }
+   if _, _, err = tagger.DecodePosterior([]string{"barks", "the"}); err == nil {
+      t.Error("impossible sequence decoded by posterior")
+   }
+
+   // a second-order model over the same vocabularies
+   observations := make([][]int, len(corpus))
+   states := make([][]int, len(corpus))
+   for c, pair := range corpus {
+      observations[c], _ = tagger.Symbols.Encode(pair[0])
+      states[c], _ = tagger.States.Encode(pair[1])
+   }
+   second, err := SecondOrderSupervisedLearner(observations, states, 0.1)
+   if err != nil {
+      t.Fatal(err)
+   }
+   tagger = &Tagger{HMM: second, Symbols: tagger.Symbols, States: tagger.States}
+   tags, err = tagger.Decode([]string{"a", "dog", "sleeps"})
+   if err != nil || !reflect.DeepEqual(tags, []string{"DET", "NOUN", "VERB"}) {
+      t.Error(tags, err)
+   }
+   if tags, _, err = tagger.DecodePosterior([]string{"the", "cat"}); err != nil || !reflect.DeepEqual(tags, []string{"DET", "NOUN"}) {
+      t.Error(tags, err)
+   }
+   if _, err = ModelOfTagger(tagger); err == nil {
+      t.Error("second-order tagger saved")
+   }
+}
+
 func TestBasicHMMScale (t *testing.T) {
    m := MakeBasicHMM(3, 2)
    m.FillA([][]float64{
@@ -127,6 +995,366 @@ func TestBasicHMMScale (t *testing.T) {
    }
 }
 
+func TestLoadSave (t *testing.T) {
+   trainer := NewTaggerTrainer(0.5)
+   trainer.Add([]string{"the", "dog", "barks"}, []string{"DET", "NOUN", "VERB"})
+   tagger := trainer.Tagger()
+   model, err := ModelOfTagger(tagger)
+   if err != nil {
+      t.Fatal(err)
+   }
+   model.Metadata = map[string]string{"corpus": "toy"}
+
+   var buf bytes.Buffer
+   if err := Save(&buf, model); err != nil {
+      t.Fatal(err)
+   }
+   if !strings.Contains(buf.String(), `"Version":1`) {
+      t.Error(buf.String())
+   }
+   back, err := Load(&buf, 1e-9)
+   if err != nil {
+      t.Fatal(err)
+   }
+   assertSameHMM(t, back.HMM, model.HMM, 0)
+   if back.Metadata["corpus"] != "toy" || !reflect.DeepEqual(back.Symbols.Words(), tagger.Symbols.Words()) || !reflect.DeepEqual(back.States.Words(), tagger.States.Words()) {
+      t.Error(back)
+   }
+   if g, err := back.Tagger(); err != nil {
+      t.Error(err)
+   } else if tags, _ := g.Decode([]string{"the", "dog"}); !reflect.DeepEqual(tags, []string{"DET", "NOUN"}) {
+      t.Error(tags)
+   }
+
+   // the plain format loads as version 0; no vocabularies
+   back, err = Load(strings.NewReader(StringifyBasicHMM(initTestData().(*BasicHMM))), 1e-9)
+   if err != nil || back.Symbols != nil {
+      t.Fatal(err)
+   }
+   if _, err := back.Tagger(); err == nil {
+      t.Error("tagger without vocabularies")
+   }
+   if err := Save(&buf, nil); err == nil {
+      t.Error("nil model saved")
+   }
+   nan := MakeBasicHMM(1, 1)
+   nan.SetPi(0, math.NaN())
+   if err := Save(&buf, &Model{HMM: nan}); err == nil {
+      t.Error("NaN saved")
+   }
+}
+
+func TestLoadInvalid (t *testing.T) {
+   cases := []struct {
+      raw       string
+      tolerance float64
+   }{
+      {`{"N":2,"M":1`, 1e-9},
+      {`{"Version":2,"N":0,"M":0,"A":[],"B":[],"Pi":[]}`, 1e-9},
+      {`{"N":2,"M":1,"A":[[1,0],[1]],"B":[[1],[1]],"Pi":[1,0]}`, 1e-9},
+      {`{"N":2,"M":1,"A":[[1,0]],"B":[[1],[1]],"Pi":[1,0]}`, 1e-9},
+      {`{"N":2,"M":2,"A":[[1,0],[0,1]],"B":[[1],[1]],"Pi":[1,0]}`, 1e-9},
+      {`{"N":1,"M":1,"A":[[0.9]],"B":[[1]],"Pi":[1]}`, 1e-3},
+      {`{"N":1,"M":2,"A":[[1]],"B":[[1.5,-0.5]],"Pi":[1]}`, 1e-3},
+      {`{"N":1,"M":1,"A":[[1]],"B":[[1]],"Pi":[0]}`, 1e-3},
+      {`{"N":1,"M":1,"A":[[1]],"B":[[1]],"Pi":[1],"States":{"Words":["a","b"]}}`, 1e-3},
+      {`{"N":1,"M":1,"A":[[1]],"B":[[1]],"Pi":[1],"Symbols":{"Words":["a"],"Unknown":true}}`, 1e-3},
+   }
+   for k, c := range cases {
+      if _, err := Load(strings.NewReader(c.raw), c.tolerance); err == nil {
+         t.Error(k, "accepted", c.raw)
+      }
+   }
+
+   // within tolerance, unvisited states and raw counts
+   valid := []struct {
+      raw       string
+      tolerance float64
+   }{
+      {`{"N":1,"M":1,"A":[[0.9999]],"B":[[1]],"Pi":[1]}`, 1e-3},
+      {`{"N":2,"M":1,"A":[[1,0],[0,0]],"B":[[1],[0]],"Pi":[1,0]}`, 1e-9},
+      {`{"N":1,"M":2,"A":[[3]],"B":[[2,5]],"Pi":[1]}`, -1},
+   }
+   for k, c := range valid {
+      if _, err := Load(strings.NewReader(c.raw), c.tolerance); err != nil {
+         t.Error(k, err)
+      }
+   }
+   if ParseBasicHMM(`{"N":2,"M":1,"A":[[1,0],[1]],"B":[[1],[1]],"Pi":[1,0]}`) != nil {
+      t.Error("short row parsed")
+   }
+}
+
+func initTestSecondOrder (n, m int, seed int64) *SecondOrderHMM {
+   r := rand.New(rand.NewSource(seed))
+   row := func (k int) []float64 {
+      v := make([]float64, k)
+      sum := 0.0
+      for i := range v {
+         v[i] = 0.1 + r.Float64()
+         sum += v[i]
+      }
+      for i := range v {
+         v[i] /= sum
+      }
+      return v
+   }
+   h := MakeSecondOrderHMM(n, m)
+   for i := 0; i <= n; i++ {
+      for j := 0; j < n; j++ {
+         for k, p := range row(n) {
+            h.SetA2(i, j, k, p)
+         }
+      }
+   }
+   for i := 0; i < n; i++ {
+      for o, p := range row(m) {
+         h.SetB(i, o, p)
+      }
+   }
+   for k, p := range row(n) {
+      h.SetPi(k, p)
+   }
+   return h
+}
+
+func TestSecondOrderHMM (t *testing.T) {
+   h := initTestSecondOrder(3, 2, 1)
+   observation := []int{0, 1, 1, 0, 1}
+   // enumerate every state path
+   n := h.N()
+   paths := 1
+   for range observation {
+      paths *= n
+   }
+   lnPs := make([]float64, paths)
+   states := make([][]int, paths)
+   gamma := make([][]float64, len(observation))
+   for step := range gamma {
+      gamma[step] = make([]float64, n)
+   }
+   for p := 0; p < paths; p++ {
+      state := make([]int, len(observation))
+      x := p
+      for step := range state {
+         state[step] = x % n
+         x /= n
+      }
+      lnp := math.Log(h.Pi(state[0]) * h.B(state[0], observation[0]))
+      for step := 1; step < len(state); step++ {
+         i := n
+         if step > 1 {
+            i = state[step - 2]
+         }
+         lnp += math.Log(h.A2(i, state[step - 1], state[step]) * h.B(state[step], observation[step]))
+      }
+      lnPs[p], states[p] = lnp, state
+   }
+   total := LogSumExp(lnPs)
+   for p, state := range states {
+      for step, i := range state {
+         gamma[step][i] += math.Exp(lnPs[p] - total)
+      }
+   }
+   sort.Stable(byLnP{lnPs, states})
+
+   var decoder Decoder = h
+   lnP, forward, scale := SecondOrderForwardCalculator(h, observation)
+   lnPb, _ := SecondOrderBackwardCalculator(h, observation, scale)
+   if math.Abs(lnP - total) > epsilon || math.Abs(lnPb - total) > epsilon || math.Abs(decoder.LogLikelihood(observation) - total) > epsilon {
+      t.Error(lnP, lnPb, total)
+   }
+   if len(forward[0]) != (n + 1) * n {
+      t.Error(len(forward[0]))
+   }
+   best, state := decoder.Viterbi(observation)
+   if math.Abs(best - lnPs[0]) > epsilon || !reflect.DeepEqual(state, states[0]) {
+      t.Error(best, state, lnPs[0], states[0])
+   }
+   nbest, nstates := decoder.ViterbiNBest(observation, 5)
+   for r := 0; r < 5; r++ {
+      if math.Abs(nbest[r] - lnPs[r]) > epsilon {
+         t.Error(r, nbest[r], lnPs[r], nstates[r])
+      }
+   }
+   _, posterior := decoder.StatePosterior(observation)
+   for step := range gamma {
+      for i := range gamma[step] {
+         if math.Abs(posterior[step][i] - gamma[step][i]) > epsilon {
+            t.Error(step, i, posterior[step][i], gamma[step][i])
+         }
+      }
+   }
+   decoded, confidence := decoder.PosteriorDecode(observation)
+   for step, i := range decoded {
+      if confidence[step] != posterior[step][i] {
+         t.Error(step, decoded, confidence)
+      }
+   }
+}
+
+// hides the link lists of a sparse chain
+type denseTestChain struct {
+   MarkovChain
+}
+
+func TestSecondOrderChainLinks (t *testing.T) {
+   h := initTestSecondOrder(3, 2, 2)
+   c := new_second_order_chain(h)
+   links := 0
+   for p := 0; p < c.N(); p++ {
+      for q := 0; q < c.N(); q++ {
+         in_to, in_from := false, false
+         for _, j := range c.successors(p) {
+            in_to = in_to || j == q
+         }
+         for _, i := range c.predecessors(q) {
+            in_from = in_from || i == p
+         }
+         if in_to != in_from || (c.A(p, q) > 0 && !in_to) {
+            t.Fatal(p, q, c.A(p, q), in_to, in_from)
+         }
+         if in_to {
+            links ++
+         }
+      }
+   }
+   // (n+1)*n pairs, each with n successors
+   if links != 4 * 3 * 3 {
+      t.Error(links)
+   }
+
+   observation := []int{0, 1, 1, 0, 1, 1, 0}
+   lk := h.pair_likelihood(observation, false)
+   emission := h.pair_likelihood(observation, true)
+   dense := denseTestChain{c}
+   lnP, forward, scale := scaled_forward(c, lk)
+   expect, expect_forward, _ := scaled_forward(dense, lk)
+   lnPb, backward := scaled_backward(c, lk, scale)
+   _, expect_backward := scaled_backward(dense, lk, scale)
+   lnPl, _ := log_forward(c, emission)
+   lnPlb, _ := log_backward(c, emission)
+   for _, v := range []float64{lnP, lnPb, lnPl, lnPlb} {
+      if math.Abs(v - expect) > epsilon {
+         t.Error(v, expect)
+      }
+   }
+   for step := range forward {
+      for p := range forward[step] {
+         if math.Abs(forward[step][p] - expect_forward[step][p]) > epsilon ||
+            math.Abs(backward[step][p] - expect_backward[step][p]) > epsilon {
+            t.Fatal(step, p)
+         }
+      }
+   }
+   best, state := viterbi(c, emission)
+   expect_best, expect_state := viterbi(dense, emission)
+   if best != expect_best || !reflect.DeepEqual(state, expect_state) {
+      t.Error(best, state, expect_best, expect_state)
+   }
+}
+
+func TestSecondOrderAsFirstOrder (t *testing.T) {
+   // transitions that ignore q_t-2 make a first-order model
+   first := initTestData().(*BasicHMM)
+   h := MakeSecondOrderHMM(first.N(), first.M())
+   for i := 0; i <= first.N(); i++ {
+      for j := 0; j < first.N(); j++ {
+         for k := 0; k < first.N(); k++ {
+            h.SetA2(i, j, k, first.A(j, k))
+         }
+      }
+   }
+   h.b = *first.GetB()
+   h.pi = *first.GetPi()
+   observation := initTestObservation(first, 300)
+   for _, d := range []Decoder{first, h} {
+      if math.Abs(d.LogLikelihood(observation) - first.LogLikelihood(observation)) > 1e-9 {
+         t.Error(d.LogLikelihood(observation))
+      }
+      lnP, state := d.Viterbi(observation)
+      expect, expect_state := ViterbiCalculator(first, observation)
+      if math.Abs(lnP - expect) > 1e-9 || !reflect.DeepEqual(state, expect_state) {
+         t.Error(lnP, expect)
+      }
+   }
+}
+
+func TestSecondOrderTrainer (t *testing.T) {
+   // states cycle 0 1 1 0 1 1 ...: after a 1, only the state before tells
+   // what comes next; emissions are noisy
+   r := rand.New(rand.NewSource(1))
+   generate := func (length int) ([]int, []int) {
+      observation := make([]int, length)
+      state := make([]int, length)
+      offset := r.Intn(3)
+      for t := range state {
+         if (t + offset) % 3 != 0 {
+            state[t] = 1
+         }
+         observation[t] = state[t]
+         if r.Float64() < 0.3 {
+            observation[t] = 1 - state[t]
+         }
+      }
+      return observation, state
+   }
+   second := NewSecondOrderTrainer(1)
+   first := NewSupervisedTrainer(0, 0, 1)
+   for k := 0; k < 50; k++ {
+      observation, state := generate(30)
+      if err := second.Add(observation, state); err != nil {
+         t.Fatal(err)
+      }
+      first.Add(observation, state)
+   }
+   l1, l2, l3 := second.Lambdas()
+   if math.Abs(l1 + l2 + l3 - 1) > epsilon || l3 < l2 || l3 < l1 {
+      t.Error(l1, l2, l3)
+   }
+   h := second.Model()
+   for i := 0; i <= h.N(); i++ {
+      for j := 0; j < h.N(); j++ {
+         sum := 0.0
+         for k := 0; k < h.N(); k++ {
+            sum += h.A2(i, j, k)
+         }
+         if math.Abs(sum - 1) > epsilon {
+            t.Error(i, j, sum)
+         }
+      }
+   }
+   if err := ValidateHMM(first.Model(), epsilon); err != nil {
+      t.Error(err)
+   }
+
+   right1, right2, total := 0, 0, 0
+   for k := 0; k < 20; k++ {
+      observation, state := generate(30)
+      _, s1 := first.Model().Viterbi(observation)
+      _, s2 := h.Viterbi(observation)
+      for step := range state {
+         if s1[step] == state[step] {
+            right1 ++
+         }
+         if s2[step] == state[step] {
+            right2 ++
+         }
+         total ++
+      }
+   }
+   if right2 <= right1 || float64(right2) < 0.9 * float64(total) {
+      t.Error("second order", right2, "first order", right1, "of", total)
+   }
+
+   if err := second.Add([]int{0}, []int{0, 1}); err == nil {
+      t.Error("length mismatch accepted")
+   }
+   if _, err := SecondOrderSupervisedLearner([][]int{{0}}, nil, 1); err == nil {
+      t.Error("sequence count mismatch accepted")
+   }
+}
+
 func TestBasicHMMParse (t *testing.T) {
    m := ParseBasicHMM(`{"N":2,"M":1,"A":[[1,2],[3,4]],"B":[[5],[6]],"Pi":[7,8]}`)
    fmt.Println(m)
@@ -0,0 +1,62 @@
+package hmm
+
+// Posteriors are computed from the scaled forward/backward variables, so they
+// work for any sequence length. For an impossible observation (lnP = -Inf)
+// all posteriors are zero.
+
+// gamma[t][i] = P(q_t = i | O)
+func StatePosteriorCalculator (hmm HiddenMarkovModel, observation []int) (lnP float64, gamma [][]float64) {
+   lnP, forward, scale := ScaledForwardCalculator(hmm, observation)
+   _, backward := ScaledBackwardCalculator(hmm, observation, scale)
+   gamma = state_posterior(forward, backward)
+   return
+}
+
+// xi[t][i][j] = P(q_t = i, q_t+1 = j | O) for t = 0..len(observation)-2
+func TransitionPosteriorCalculator (hmm HiddenMarkovModel, observation []int) (lnP float64, xi [][][]float64) {
+   lk := discrete_likelihood(hmm, observation)
+   lnP, forward, scale := scaled_forward(hmm, lk)
+   _, backward := scaled_backward(hmm, lk, scale)
+   xi = transition_posterior(hmm, lk, forward, backward, scale)
+   return
+}
+
+// Maximum posterior decoding: state[t] = argmax_i gamma[t][i], with
+// confidence[t] = gamma[t][state[t]]. Unlike Viterbi, the path as a whole may
+// be impossible (e.g. it may take a zero transition).
+func PosteriorDecoder (hmm HiddenMarkovModel, observation []int) (state []int, confidence []float64) {
+   _, gamma := StatePosteriorCalculator(hmm, observation)
+   return posterior_decode(gamma)
+}
+
+func state_posterior (forward, backward [][]float64) [][]float64 {
+   gamma := make([][]float64, len(forward))
+   for t := range forward {
+      gamma[t] = make([]float64, len(forward[t]))
+      for i := range forward[t] {
+         gamma[t][i] = forward[t][i] * backward[t][i]
+      }
+   }
+   return gamma
+}
+
+// lk[t][i] = p(o_t | q_t = i) as given to scaled_forward
+func transition_posterior (hmm MarkovChain, lk, forward, backward [][]float64, scale []float64) [][][]float64 {
+   obn := len(lk)
+   stn := hmm.N()
+   xi := make([][][]float64, 0, obn)
+   for t := 0; t < obn - 1; t++ {
+      xit := make([][]float64, stn)
+      for i := 0; i < stn; i++ {
+         xit[i] = make([]float64, stn)
+         if scale[t+1] == 0 {
+            continue
+         }
+         for j := 0; j < stn; j++ {
+            xit[i][j] = forward[t][i] * hmm.A(i, j) * lk[t+1][j] * backward[t+1][j] / scale[t+1]
+         }
+      }
+      xi = append(xi, xit)
+   }
+   return xi
+}
@@ -0,0 +1,40 @@
+package hmm
+
+import (
+   "math/rand"
+)
+
+// Draw a hidden state path from Pi and A and an observation for every state
+// from B. rng makes the draw reproducible; nil uses the global source of
+// math/rand. Rows of hmm need not be exactly normalized: whatever remains of
+// a row after the other entries goes to its last entry.
+func Sample (hmm HiddenMarkovModel, length int, rng *rand.Rand) (state, observation []int) {
+   state       = make([]int, length)
+   observation = make([]int, length)
+   uniform := rand.Float64
+   if rng != nil {
+      uniform = rng.Float64
+   }
+   pick := func (p func (int) float64, n int) int {
+      x := uniform()
+      for i := 0; i < n - 1; i++ {
+         x -= p(i)
+         if x < 0 {
+            return i
+         }
+      }
+      return n - 1
+   }
+
+   for t := 0; t < length; t++ {
+      if t == 0 {
+         state[t] = pick(hmm.Pi, hmm.N())
+      } else {
+         from := state[t-1]
+         state[t] = pick(func (to int) float64 { return hmm.A(from, to) }, hmm.N())
+      }
+      current := state[t]
+      observation[t] = pick(func (o int) float64 { return hmm.B(current, o) }, hmm.M())
+   }
+   return
+}
@@ -0,0 +1,228 @@
+package hmm
+
+import (
+   "math"
+)
+
+// Second-order HMM: the state at step t depends on the states at t-1 and
+// t-2. Context index n stands for the start of the sequence, so that
+// A2(n, j, k) is the transition from the first state j to the second one.
+//
+// The algorithms run on the equivalent first-order chain over state pairs
+// (q_t-1, q_t), which has (n+1)*n states.
+type SecondOrderHMM struct {
+   n  int
+   m  int
+   a  [][][]float64 // [n+1][n][n]
+   b  [][]float64
+   pi []float64
+}
+
+func MakeSecondOrderHMM (n, m int) *SecondOrderHMM {
+   h := new(SecondOrderHMM)
+   h.n = n
+   h.m = m
+   h.a = make([][][]float64, n + 1)
+   for i := 0; i <= n; i++ {
+      h.a[i] = make([][]float64, n)
+      for j := 0; j < n; j++ {
+         h.a[i][j] = make([]float64, n)
+      }
+   }
+   h.b = make([][]float64, n)
+   for i := 0; i < n; i++ {
+      h.b[i] = make([]float64, m)
+   }
+   h.pi = make([]float64, n)
+   return h
+}
+
+func (h *SecondOrderHMM) N () int {
+   return h.n
+}
+
+func (h *SecondOrderHMM) M () int {
+   return h.m
+}
+
+// P(q_t = k | q_t-2 = i, q_t-1 = j); i = N() is the start of the sequence
+func (h *SecondOrderHMM) A2 (i, j, k int) float64 {
+   return h.a[i][j][k]
+}
+
+func (h *SecondOrderHMM) B (i, j int) float64 {
+   return h.b[i][j]
+}
+
+func (h *SecondOrderHMM) Pi (i int) float64 {
+   return h.pi[i]
+}
+
+func (h *SecondOrderHMM) SetA2 (i, j, k int, v float64) bool {
+   h.a[i][j][k] = v
+   return true
+}
+
+func (h *SecondOrderHMM) SetB (i, j int, v float64) bool {
+   h.b[i][j] = v
+   return true
+}
+
+func (h *SecondOrderHMM) SetPi (i int, v float64) bool {
+   h.pi[i] = v
+   return true
+}
+
+// First-order view over state pairs: pair p = i * n + j is (q_t-1 = i,
+// q_t = j), with i = n before the first step. Pair (i, j) only moves on to
+// the n pairs (j, k), so the algorithms run in O(T * n^3) over the
+// predecessor and successor lists rather than O(T * n^4).
+type second_order_chain struct {
+   h    *SecondOrderHMM
+   from [][]int
+   to   [][]int
+}
+
+func new_second_order_chain (h *SecondOrderHMM) *second_order_chain {
+   n := h.n
+   c := &second_order_chain{h, make([][]int, (n + 1) * n), make([][]int, (n + 1) * n)}
+   for p := range c.to {
+      j := p % n
+      c.to[p] = make([]int, n)
+      for k := 0; k < n; k++ {
+         c.to[p][k] = j * n + k
+      }
+      // nothing moves to a start pair
+      if p / n < n {
+         c.from[p] = make([]int, n + 1)
+         for i := 0; i <= n; i++ {
+            c.from[p][i] = i * n + p / n
+         }
+      }
+   }
+   return c
+}
+
+func (c *second_order_chain) N () int {
+   return (c.h.n + 1) * c.h.n
+}
+
+func (c *second_order_chain) Pi (p int) float64 {
+   if p / c.h.n != c.h.n {
+      return 0
+   }
+   return c.h.pi[p % c.h.n]
+}
+
+func (c *second_order_chain) A (p, q int) float64 {
+   n := c.h.n
+   if q / n != p % n {
+      return 0
+   }
+   return c.h.a[p / n][p % n][q % n]
+}
+
+func (c *second_order_chain) predecessors (q int) []int {
+   return c.from[q]
+}
+
+func (c *second_order_chain) successors (p int) []int {
+   return c.to[p]
+}
+
+// emission matrix over pairs: the current state of a pair emits
+func (h *SecondOrderHMM) pair_likelihood (observation []int, log bool) [][]float64 {
+   lk := make([][]float64, len(observation))
+   for t, o := range observation {
+      lk[t] = make([]float64, (h.n + 1) * h.n)
+      for p := range lk[t] {
+         lk[t][p] = h.b[p % h.n][o]
+         if log {
+            lk[t][p] = math.Log(lk[t][p])
+         }
+      }
+   }
+   return lk
+}
+
+// current states of a pair path
+func (h *SecondOrderHMM) pair_states (pairs []int) []int {
+   state := make([]int, len(pairs))
+   for t, p := range pairs {
+      state[t] = p % h.n
+   }
+   return state
+}
+
+// sum a pair posterior over the previous state
+func (h *SecondOrderHMM) pair_marginal (gamma [][]float64) [][]float64 {
+   r := make([][]float64, len(gamma))
+   for t, row := range gamma {
+      r[t] = make([]float64, h.n)
+      for p, g := range row {
+         r[t][p % h.n] += g
+      }
+   }
+   return r
+}
+
+// As ScaledForwardCalculator, over pairs: forward[t][p] with p = i * N() + j
+// for (q_t-1 = i, q_t = j).
+func SecondOrderForwardCalculator (hmm *SecondOrderHMM, observation []int) (lnP float64, forward [][]float64, scale []float64) {
+   return scaled_forward(new_second_order_chain(hmm), hmm.pair_likelihood(observation, false))
+}
+
+// As ScaledBackwardCalculator, over pairs.
+func SecondOrderBackwardCalculator (hmm *SecondOrderHMM, observation []int, scale []float64) (lnP float64, backward [][]float64) {
+   return scaled_backward(new_second_order_chain(hmm), hmm.pair_likelihood(observation, false), scale)
+}
+
+func SecondOrderViterbiCalculator (hmm *SecondOrderHMM, observation []int) (lnP float64, state []int) {
+   lnP, pairs := viterbi(new_second_order_chain(hmm), hmm.pair_likelihood(observation, true))
+   return lnP, hmm.pair_states(pairs)
+}
+
+// As ViterbiNBestCalculator; a state path has exactly one pair path, so the
+// paths are distinct.
+func SecondOrderViterbiNBestCalculator (hmm *SecondOrderHMM, observation []int, k int) (lnP []float64, states [][]int) {
+   lnP, pairs := viterbi_nbest(new_second_order_chain(hmm), hmm.pair_likelihood(observation, true), k)
+   states = make([][]int, len(pairs))
+   for r, p := range pairs {
+      states[r] = hmm.pair_states(p)
+   }
+   return
+}
+
+// gamma[t][i] = P(q_t = i | O)
+func SecondOrderStatePosteriorCalculator (hmm *SecondOrderHMM, observation []int) (lnP float64, gamma [][]float64) {
+   lnP, forward, scale := SecondOrderForwardCalculator(hmm, observation)
+   _, backward := SecondOrderBackwardCalculator(hmm, observation, scale)
+   gamma = hmm.pair_marginal(state_posterior(forward, backward))
+   return
+}
+
+func SecondOrderPosteriorDecoder (hmm *SecondOrderHMM, observation []int) (state []int, confidence []float64) {
+   _, gamma := SecondOrderStatePosteriorCalculator(hmm, observation)
+   return posterior_decode(gamma)
+}
+
+func (h *SecondOrderHMM) LogLikelihood (observation []int) float64 {
+   lnP, _, _ := SecondOrderForwardCalculator(h, observation)
+   return lnP
+}
+
+func (h *SecondOrderHMM) Viterbi (observation []int) (float64, []int) {
+   return SecondOrderViterbiCalculator(h, observation)
+}
+
+func (h *SecondOrderHMM) ViterbiNBest (observation []int, k int) ([]float64, [][]int) {
+   return SecondOrderViterbiNBestCalculator(h, observation, k)
+}
+
+func (h *SecondOrderHMM) StatePosterior (observation []int) (float64, [][]float64) {
+   return SecondOrderStatePosteriorCalculator(h, observation)
+}
+
+func (h *SecondOrderHMM) PosteriorDecode (observation []int) ([]int, []float64) {
+   return SecondOrderPosteriorDecoder(h, observation)
+}
@@ -0,0 +1,201 @@
+package hmm
+
+import (
+   "fmt"
+)
+
+// index of the start of a sequence in the counts
+const second_order_start = -1
+
+// Supervised maximum likelihood for a SecondOrderHMM. Trigram transitions
+// are sparse, so Model smooths them by deleted interpolation (Brants, TnT,
+// 2000):
+//
+//    P(k | i, j) = l1 P(k) + l2 P(k | j) + l3 P(k | i, j)
+//
+// with the weights estimated from the counts themselves. Emissions get add-k
+// smoothing as in SupervisedTrainer. Like SupervisedTrainer it keeps counts,
+// so more labelled data can be folded in at any time.
+type SecondOrderTrainer struct {
+   K        float64
+   n, m     int
+   tokens   float64
+   unigram  map[int]float64
+   bigram   map[[2]int]float64
+   trigram  map[[3]int]float64
+   emission map[[2]int]float64
+}
+
+func NewSecondOrderTrainer (k float64) *SecondOrderTrainer {
+   s := new(SecondOrderTrainer)
+   s.K = k
+   s.unigram = make(map[int]float64)
+   s.bigram = make(map[[2]int]float64)
+   s.trigram = make(map[[3]int]float64)
+   s.emission = make(map[[2]int]float64)
+   return s
+}
+
+func (s *SecondOrderTrainer) Add (observation, state []int) error {
+   if len(observation) != len(state) {
+      return fmt.Errorf("hmm: %d observations but %d states", len(observation), len(state))
+   }
+   for t := range state {
+      if state[t] < 0 || observation[t] < 0 {
+         return fmt.Errorf("hmm: negative state or symbol at step %d", t)
+      }
+   }
+   i, j := second_order_start, second_order_start
+   for t, k := range state {
+      s.unigram[k] ++
+      s.bigram[[2]int{j, k}] ++
+      s.trigram[[3]int{i, j, k}] ++
+      s.emission[[2]int{k, observation[t]}] ++
+      s.tokens ++
+      if k >= s.n {
+         s.n = k + 1
+      }
+      if observation[t] >= s.m {
+         s.m = observation[t] + 1
+      }
+      i, j = j, k
+   }
+   return nil
+}
+
+func (s *SecondOrderTrainer) AddAll (observations, states [][]int) error {
+   if len(observations) != len(states) {
+      return fmt.Errorf("hmm: %d observation sequences but %d state sequences", len(observations), len(states))
+   }
+   for k := range observations {
+      if err := s.Add(observations[k], states[k]); err != nil {
+         return err
+      }
+   }
+   return nil
+}
+
+// how often a context is followed by any state
+func (s *SecondOrderTrainer) contexts () (map[int]float64, map[[2]int]float64) {
+   ctx1 := make(map[int]float64)
+   ctx2 := make(map[[2]int]float64)
+   for key, c := range s.bigram {
+      ctx1[key[0]] += c
+   }
+   for key, c := range s.trigram {
+      ctx2[[2]int{key[0], key[1]}] += c
+   }
+   return ctx1, ctx2
+}
+
+// Deleted interpolation weights of the unigram, bigram and trigram estimates:
+// every trigram votes with its count for the estimate that predicts it best
+// once that very trigram is taken out of the counts.
+func (s *SecondOrderTrainer) Lambdas () (l1, l2, l3 float64) {
+   ctx1, ctx2 := s.contexts()
+   ratio := func (x, y float64) float64 {
+      if y <= 0 {
+         return 0
+      }
+      return x / y
+   }
+   for key, c := range s.trigram {
+      i, j, k := key[0], key[1], key[2]
+      c3 := ratio(c - 1, ctx2[[2]int{i, j}] - 1)
+      c2 := ratio(s.bigram[[2]int{j, k}] - 1, ctx1[j] - 1)
+      c1 := ratio(s.unigram[k] - 1, s.tokens - 1)
+      switch {
+      case c3 >= c2 && c3 >= c1:
+         l3 += c
+      case c2 >= c1:
+         l2 += c
+      default:
+         l1 += c
+      }
+   }
+   sum := l1 + l2 + l3
+   if sum == 0 {
+      return 1.0 / 3, 1.0 / 3, 1.0 / 3
+   }
+   return l1 / sum, l2 / sum, l3 / sum
+}
+
+// The smoothed, normalized model of the counts so far.
+func (s *SecondOrderTrainer) Model () *SecondOrderHMM {
+   n := s.n
+   h := MakeSecondOrderHMM(n, s.m)
+   l1, l2, l3 := s.Lambdas()
+   ctx1, ctx2 := s.contexts()
+
+   // interpolated P(k | i, j); estimates of unseen contexts are left out and
+   // the weights of the others renormalized
+   transition := func (i, j int) []float64 {
+      r := make([]float64, n)
+      weight := 0.0
+      if s.tokens > 0 {
+         weight += l1
+      }
+      if ctx1[j] > 0 {
+         weight += l2
+      }
+      if ctx2[[2]int{i, j}] > 0 {
+         weight += l3
+      }
+      for k := 0; k < n; k++ {
+         if weight == 0 {
+            r[k] = 1 / float64(n)
+            continue
+         }
+         if s.tokens > 0 {
+            r[k] += l1 * s.unigram[k] / s.tokens
+         }
+         if ctx1[j] > 0 {
+            r[k] += l2 * s.bigram[[2]int{j, k}] / ctx1[j]
+         }
+         if ctx2[[2]int{i, j}] > 0 {
+            r[k] += l3 * s.trigram[[3]int{i, j, k}] / ctx2[[2]int{i, j}]
+         }
+         r[k] /= weight
+      }
+      return r
+   }
+
+   for k, p := range transition(second_order_start, second_order_start) {
+      h.SetPi(k, p)
+   }
+   for i := 0; i <= n; i++ {
+      context := i
+      if i == n {
+         context = second_order_start
+      }
+      for j := 0; j < n; j++ {
+         for k, p := range transition(context, j) {
+            h.SetA2(i, j, k, p)
+         }
+      }
+   }
+
+   for i := 0; i < n; i++ {
+      sum := 0.0
+      for o := 0; o < s.m; o++ {
+         sum += s.emission[[2]int{i, o}] + s.K
+      }
+      if sum == 0 {
+         continue
+      }
+      for o := 0; o < s.m; o++ {
+         h.SetB(i, o, (s.emission[[2]int{i, o}] + s.K) / sum)
+      }
+   }
+   return h
+}
+
+// Train a second-order model on labelled sequences in one go; k smooths the
+// emissions.
+func SecondOrderSupervisedLearner (observations, states [][]int, k float64) (*SecondOrderHMM, error) {
+   s := NewSecondOrderTrainer(k)
+   if err := s.AddAll(observations, states); err != nil {
+      return nil, err
+   }
+   return s.Model(), nil
+}
@@ -0,0 +1,156 @@
+package hmm
+
+import (
+   "encoding/json"
+   "fmt"
+   "io"
+   "math"
+)
+
+// Version written by Save. Files without a version are the plain
+// StringifyBasicHMM format and load as version 0.
+const FormatVersion = 1
+
+// Contents of a model file: the HMM with optional vocabularies of its
+// observation symbols and states, and free-form metadata.
+type Model struct {
+   HMM      *BasicHMM
+   Symbols  *Vocabulary
+   States   *Vocabulary
+   Metadata map[string]string
+}
+
+type model_json struct {
+   Version  int
+   N        int
+   M        int
+   A        [][]float64
+   B        [][]float64
+   Pi       []float64
+   Symbols  *Vocabulary       `json:",omitempty"`
+   States   *Vocabulary       `json:",omitempty"`
+   Metadata map[string]string `json:",omitempty"`
+}
+
+// Model of a Tagger, sharing its parts; only a BasicHMM has a file format.
+func ModelOfTagger (g *Tagger) (*Model, error) {
+   h, ok := g.HMM.(*BasicHMM)
+   if !ok {
+      return nil, fmt.Errorf("hmm: cannot save a tagger over %T", g.HMM)
+   }
+   return &Model{HMM: h, Symbols: g.Symbols, States: g.States}, nil
+}
+
+func (m *Model) Tagger () (*Tagger, error) {
+   if m.Symbols == nil || m.States == nil {
+      return nil, fmt.Errorf("hmm: a tagger needs both vocabularies")
+   }
+   return &Tagger{HMM: m.HMM, Symbols: m.Symbols, States: m.States}, nil
+}
+
+func Save (w io.Writer, m *Model) error {
+   if m == nil || m.HMM == nil {
+      return fmt.Errorf("hmm: no model to save")
+   }
+   tmp := model_json{
+      Version: FormatVersion,
+      N: m.HMM.N(), M: m.HMM.M(),
+      A: *m.HMM.GetA(), B: *m.HMM.GetB(), Pi: *m.HMM.GetPi(),
+      Symbols: m.Symbols, States: m.States, Metadata: m.Metadata,
+   }
+   if err := json.NewEncoder(w).Encode(&tmp); err != nil {
+      return fmt.Errorf("hmm: cannot save model: %v", err)
+   }
+   return nil
+}
+
+// Read and validate a model written by Save (or StringifyBasicHMM); see
+// ValidateHMM for tolerance.
+func Load (r io.Reader, tolerance float64) (*Model, error) {
+   var tmp model_json
+   if err := json.NewDecoder(r).Decode(&tmp); err != nil {
+      return nil, fmt.Errorf("hmm: cannot load model: %v", err)
+   }
+   if tmp.Version < 0 || tmp.Version > FormatVersion {
+      return nil, fmt.Errorf("hmm: unsupported format version %d", tmp.Version)
+   }
+   if err := validate_shape(tmp.N, tmp.M, tmp.A, tmp.B, tmp.Pi); err != nil {
+      return nil, err
+   }
+   hmm := MakeBasicHMM(tmp.N, tmp.M)
+   hmm.FillA(tmp.A)
+   hmm.FillB(tmp.B)
+   hmm.FillPi(tmp.Pi)
+   if err := ValidateHMM(hmm, tolerance); err != nil {
+      return nil, err
+   }
+   if tmp.Symbols != nil && tmp.Symbols.Size() != tmp.M {
+      return nil, fmt.Errorf("hmm: %d symbols for %d observation columns", tmp.Symbols.Size(), tmp.M)
+   }
+   if tmp.States != nil && tmp.States.Size() != tmp.N {
+      return nil, fmt.Errorf("hmm: %d state names for %d states", tmp.States.Size(), tmp.N)
+   }
+   return &Model{HMM: hmm, Symbols: tmp.Symbols, States: tmp.States, Metadata: tmp.Metadata}, nil
+}
+
+func validate_shape (n, m int, a, b [][]float64, pi []float64) error {
+   if n < 0 || m < 0 {
+      return fmt.Errorf("hmm: negative size %dx%d", n, m)
+   }
+   if len(a) != n || len(b) != n || len(pi) != n {
+      return fmt.Errorf("hmm: A, B and Pi need %d rows, got %d, %d and %d", n, len(a), len(b), len(pi))
+   }
+   for i := 0; i < n; i++ {
+      if len(a[i]) != n {
+         return fmt.Errorf("hmm: row %d of A has %d columns, want %d", i, len(a[i]), n)
+      }
+      if len(b[i]) != m {
+         return fmt.Errorf("hmm: row %d of B has %d columns, want %d", i, len(b[i]), m)
+      }
+   }
+   return nil
+}
+
+// Check that every probability is finite and non-negative and that Pi and
+// every row of A and B sum to 1 within tolerance. All-zero rows of A and B
+// (states never reached in training) pass. A negative tolerance only checks
+// that the values are finite, e.g. for raw counts.
+func ValidateHMM (hmm HiddenMarkovModel, tolerance float64) error {
+   n := hmm.N()
+   m := hmm.M()
+   check := func (name string, row func (int) float64, size int, allow_zero bool) error {
+      sum := 0.0
+      for j := 0; j < size; j++ {
+         v := row(j)
+         if math.IsNaN(v) || math.IsInf(v, 0) {
+            return fmt.Errorf("hmm: %s[%d] is %v", name, j, v)
+         }
+         if tolerance >= 0 && v < 0 {
+            return fmt.Errorf("hmm: %s[%d] = %v is negative", name, j, v)
+         }
+         sum += v
+      }
+      if tolerance < 0 || (allow_zero && sum == 0) {
+         return nil
+      }
+      if math.Abs(sum - 1) > tolerance {
+         return fmt.Errorf("hmm: %s sums to %v, not 1", name, sum)
+      }
+      return nil
+   }
+   if n > 0 {
+      if err := check("Pi", hmm.Pi, n, false); err != nil {
+         return err
+      }
+   }
+   for i := 0; i < n; i++ {
+      row := i
+      if err := check(fmt.Sprintf("A[%d]", i), func (j int) float64 { return hmm.A(row, j) }, n, true); err != nil {
+         return err
+      }
+      if err := check(fmt.Sprintf("B[%d]", i), func (j int) float64 { return hmm.B(row, j) }, m, true); err != nil {
+         return err
+      }
+   }
+   return nil
+}
@@ -0,0 +1,77 @@
+package hmm
+
+import (
+   "fmt"
+)
+
+// Maximum likelihood estimate from labelled sequences. Counts keeps the raw
+// counts of BasicLearner, so more labelled data can be folded in with Add at
+// any time; Model smooths and normalizes them.
+type SupervisedTrainer struct {
+   Counts *BasicHMM
+   // add-k smoothing of every count in Model; 1 is Laplace, 0 is plain
+   // maximum likelihood
+   K float64
+}
+
+// n states and m symbols to start with; Add grows the model as needed.
+func NewSupervisedTrainer (n, m int, k float64) *SupervisedTrainer {
+   s := new(SupervisedTrainer)
+   s.Counts = MakeBasicHMM(n, m)
+   s.K = k
+   return s
+}
+
+// Fold in one labelled sequence: state[t] is the hidden state behind
+// observation[t].
+func (s *SupervisedTrainer) Add (observation, state []int) error {
+   if len(observation) != len(state) {
+      return fmt.Errorf("hmm: %d observations but %d states", len(observation), len(state))
+   }
+   for t := range state {
+      if state[t] < 0 || observation[t] < 0 {
+         return fmt.Errorf("hmm: negative state or symbol at step %d", t)
+      }
+   }
+   s.Counts = BasicLearner(s.Counts, observation, state, 1)
+   return nil
+}
+
+func (s *SupervisedTrainer) AddAll (observations, states [][]int) error {
+   if len(observations) != len(states) {
+      return fmt.Errorf("hmm: %d observation sequences but %d state sequences", len(observations), len(states))
+   }
+   for k := range observations {
+      if err := s.Add(observations[k], states[k]); err != nil {
+         return err
+      }
+   }
+   return nil
+}
+
+// The normalized model of the counts so far, every count increased by K.
+// With K = 0, rows of states never seen stay zero.
+func (s *SupervisedTrainer) Model () *BasicHMM {
+   n := s.Counts.N()
+   m := s.Counts.M()
+   smoothed := MakeBasicHMM(n, m)
+   for i := 0; i < n; i++ {
+      smoothed.SetPi(i, s.Counts.Pi(i) + s.K)
+      for j := 0; j < n; j++ {
+         smoothed.SetA(i, j, s.Counts.A(i, j) + s.K)
+      }
+      for j := 0; j < m; j++ {
+         smoothed.SetB(i, j, s.Counts.B(i, j) + s.K)
+      }
+   }
+   return smoothed.Scale().(*BasicHMM)
+}
+
+// Train a normalized model on labelled sequences in one go.
+func SupervisedLearner (observations, states [][]int, k float64) (*BasicHMM, error) {
+   s := NewSupervisedTrainer(0, 0, k)
+   if err := s.AddAll(observations, states); err != nil {
+      return nil, err
+   }
+   return s.Model(), nil
+}
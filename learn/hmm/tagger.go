@@ -0,0 +1,120 @@
+package hmm
+
+import (
+   "fmt"
+   "math"
+)
+
+// HMM over string observations and named states, e.g. a part-of-speech
+// tagger: Symbols indexes the observations (B columns) and States the
+// hidden states. Any Decoder works, e.g. a SecondOrderHMM.
+type Tagger struct {
+   HMM     Decoder
+   Symbols *Vocabulary
+   States  *Vocabulary
+}
+
+func (g *Tagger) encode (words []string) ([]int, error) {
+   observation, err := g.Symbols.Encode(words)
+   if err != nil {
+      return nil, err
+   }
+   for t, o := range observation {
+      if o >= g.HMM.M() {
+         return nil, fmt.Errorf("hmm: %q has no emission in the model", words[t])
+      }
+   }
+   return observation, nil
+}
+
+// Most likely state names (Viterbi); an error when the model gives the words
+// zero probability.
+func (g *Tagger) Decode (words []string) ([]string, error) {
+   observation, err := g.encode(words)
+   if err != nil {
+      return nil, err
+   }
+   lnP, state := g.HMM.Viterbi(observation)
+   if math.IsInf(lnP, -1) {
+      return nil, fmt.Errorf("hmm: no state sequence can emit %q", words)
+   }
+   return g.States.Decode(state), nil
+}
+
+// Most likely state name at every step with its posterior probability.
+func (g *Tagger) DecodePosterior (words []string) ([]string, []float64, error) {
+   observation, err := g.encode(words)
+   if err != nil {
+      return nil, nil, err
+   }
+   lnP, gamma := g.HMM.StatePosterior(observation)
+   if math.IsInf(lnP, -1) {
+      return nil, nil, fmt.Errorf("hmm: no state sequence can emit %q", words)
+   }
+   state, confidence := posterior_decode(gamma)
+   return g.States.Decode(state), confidence, nil
+}
+
+// Supervised training on labelled string sequences; the vocabularies grow
+// with every new word and tag. Words never seen in training fall into the
+// unknown bucket of Symbols. The bucket learns its emissions from the words
+// seen only once, which are counted both as themselves and as UnknownWord,
+// so unknown words are tagged like rare words even without smoothing.
+type TaggerTrainer struct {
+   Symbols *Vocabulary
+   States  *Vocabulary
+   Trainer *SupervisedTrainer
+}
+
+func NewTaggerTrainer (k float64) *TaggerTrainer {
+   g := new(TaggerTrainer)
+   g.Symbols = NewVocabulary(true)
+   g.States = NewVocabulary(false)
+   g.Trainer = NewSupervisedTrainer(0, 0, k)
+   return g
+}
+
+func (g *TaggerTrainer) Add (words, tags []string) error {
+   if len(words) != len(tags) {
+      return fmt.Errorf("hmm: %d words but %d tags", len(words), len(tags))
+   }
+   observation := make([]int, len(words))
+   state := make([]int, len(tags))
+   for t := range words {
+      observation[t] = g.Symbols.Add(words[t])
+      state[t] = g.States.Add(tags[t])
+   }
+   return g.Trainer.Add(observation, state)
+}
+
+// Tagger of the data so far; it shares the vocabularies of the trainer.
+func (g *TaggerTrainer) Tagger () *Tagger {
+   n := g.States.Size()
+   m := g.Symbols.Size()
+   counts := MakeBasicHMM(n, m)
+   old := g.Trainer.Counts
+   for i := 0; i < old.N(); i++ {
+      counts.SetPi(i, old.Pi(i))
+      for j := 0; j < old.N(); j++ {
+         counts.SetA(i, j, old.A(i, j))
+      }
+      for j := 0; j < old.M(); j++ {
+         counts.SetB(i, j, old.B(i, j))
+      }
+   }
+   // words seen once stand for the unknown words
+   for o := 1; o < m; o++ {
+      seen := 0.0
+      for i := 0; i < n; i++ {
+         seen += counts.B(i, o)
+      }
+      if seen != 1 {
+         continue
+      }
+      for i := 0; i < n; i++ {
+         counts.SetB(i, 0, counts.B(i, 0) + counts.B(i, o))
+      }
+   }
+   model := &SupervisedTrainer{Counts: counts, K: g.Trainer.K}
+   return &Tagger{HMM: model.Model(), Symbols: g.Symbols, States: g.States}
+}
@@ -0,0 +1,121 @@
+package hmm
+
+import (
+   "encoding/json"
+   "fmt"
+)
+
+const UnknownWord = "<unk>"
+
+// Two-way mapping between strings and the dense indices the models work on.
+// With an unknown bucket, index 0 is UnknownWord and every string not in
+// the vocabulary maps to it.
+type Vocabulary struct {
+   words   []string
+   index   map[string]int
+   unknown bool
+}
+
+func NewVocabulary (unknown bool, words ...string) *Vocabulary {
+   v := new(Vocabulary)
+   v.words = make([]string, 0)
+   v.index = make(map[string]int)
+   v.unknown = unknown
+   if unknown {
+      v.Add(UnknownWord)
+   }
+   for _, word := range words {
+      v.Add(word)
+   }
+   return v
+}
+
+func (v *Vocabulary) Size () int {
+   return len(v.words)
+}
+
+func (v *Vocabulary) HasUnknown () bool {
+   return v.unknown
+}
+
+// Index of word, adding it when it is new.
+func (v *Vocabulary) Add (word string) int {
+   if i, ok := v.index[word]; ok {
+      return i
+   }
+   v.index[word] = len(v.words)
+   v.words = append(v.words, word)
+   return len(v.words) - 1
+}
+
+// Index of word; unknown words give the unknown bucket, or false without one.
+func (v *Vocabulary) Index (word string) (int, bool) {
+   if i, ok := v.index[word]; ok {
+      return i, true
+   }
+   if v.unknown {
+      return 0, true
+   }
+   return -1, false
+}
+
+// Word of index i, "" when out of range.
+func (v *Vocabulary) Word (i int) string {
+   if i < 0 || i >= len(v.words) {
+      return ""
+   }
+   return v.words[i]
+}
+
+func (v *Vocabulary) Words () []string {
+   return append([]string{}, v.words ...)
+}
+
+func (v *Vocabulary) Encode (words []string) ([]int, error) {
+   r := make([]int, len(words))
+   for t, word := range words {
+      i, ok := v.Index(word)
+      if !ok {
+         return nil, fmt.Errorf("hmm: %q is not in the vocabulary", word)
+      }
+      r[t] = i
+   }
+   return r, nil
+}
+
+func (v *Vocabulary) Decode (indices []int) []string {
+   r := make([]string, len(indices))
+   for t, i := range indices {
+      r[t] = v.Word(i)
+   }
+   return r
+}
+
+type vocabulary_json struct {
+   Words   []string
+   Unknown bool
+}
+
+func (v *Vocabulary) MarshalJSON () ([]byte, error) {
+   return json.Marshal(vocabulary_json{v.words, v.unknown})
+}
+
+func (v *Vocabulary) UnmarshalJSON (raw []byte) error {
+   var tmp vocabulary_json
+   if err := json.Unmarshal(raw, &tmp); err != nil {
+      return err
+   }
+   if tmp.Unknown && (len(tmp.Words) == 0 || tmp.Words[0] != UnknownWord) {
+      return fmt.Errorf("hmm: vocabulary with an unknown bucket must start with %q", UnknownWord)
+   }
+   r := NewVocabulary(false)
+   for _, word := range tmp.Words {
+      if _, ok := r.index[word]; ok {
+         return fmt.Errorf("hmm: %q appears twice in the vocabulary", word)
+      }
+      r.Add(word)
+   }
+   r.unknown = tmp.Unknown
+   *v = *r
+   return nil
+}
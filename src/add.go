@@ -47,10 +47,10 @@ func main () {
    nn.RandomSeed()
    n := nn.NewNeuralRecurrentChain(1, 2)
    hidden := 16
-   n.AddLayer(nn.NewLayerLinear(1, 2, hidden, 0.5, 0, true))
-   n.AddRecurrentLayer(nn.NewLayerActivation(1, hidden, "sigmoid"), "basic_recurrence")
-   n.AddLayer(nn.NewLayerLinear(1, hidden, 1, 0.5, 0, true))
-   n.AddRecurrentLayer(nn.NewLayerActivation(1, 1, "sigmoid"), "output_record")
+   n.AddLayer(nn.NewLayerLinear(1, 2, hidden, 0, true))
+   n.AddRecurrentLayer(nn.MustLayerActivation(1, hidden, "sigmoid"), "basic_recurrence")
+   n.AddLayer(nn.NewLayerLinear(1, hidden, 1, 0, true))
+   n.AddRecurrentLayer(nn.MustLayerActivation(1, 1, "sigmoid"), "output_record")
 
    error := 0
    for i := 1; i <= 20000; i++ {
@@ -86,6 +86,7 @@ func main () {
    }
 
    error = 0
+   n.SetInference(true)
    for i := 1; i <= 20000; i++ {
       n.PredictRestart()
       a_int := rand.Intn(128)
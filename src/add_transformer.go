@@ -0,0 +1,78 @@
+package main
+
+import (
+   nn "neuralnetwork"
+   "math/rand"
+   "fmt"
+)
+
+// The 8-bit adder of add.go solved by attention instead of recurrence: the
+// whole sum is one sequence of 8 positions (least significant bit first), and
+// the carries flow between positions through self-attention.
+
+func prepareSequence (a, b int) *nn.SimpleMatrix {
+   in := nn.NewSimpleMatrix(8, 2)
+   for k := 0; k < 8; k++ {
+      in.Data[k][0] = float64((a >> uint(k)) & 1)
+      in.Data[k][1] = float64((b >> uint(k)) & 1)
+   }
+   return in
+}
+
+func decodeSequence (out *nn.SimpleMatrix) int {
+   r := 0
+   for k := 0; k < 8; k++ {
+      if out.Data[k][0] > 0.5 {
+         r |= 1 << uint(k)
+      }
+   }
+   return r
+}
+
+func main () {
+   nn.RandomSeed()
+   n := nn.NewNeuralChain()
+   dim := 16
+   n.AddLayer(nn.NewLayerLinear(8, 2, dim, 0, true))
+   n.AddLayer(nn.NewLayerLearnedEncoding(8, dim, 0.1))
+   for i := 0; i < 2; i++ {
+      encoder, err := nn.NewLayerTransformerEncoder(8, dim, 2 /* heads */, 2 * dim, 1.0)
+      if err != nil {
+         panic(err)
+      }
+      n.AddLayer(encoder)
+   }
+   n.AddLayer(nn.NewLayerLinear(8, dim, 1, 0, true))
+   n.AddLayer(nn.MustLayerActivation(8, 1, "sigmoid"))
+
+   error := 0
+   for i := 1; i <= 30000; i++ {
+      a_int := rand.Intn(128)
+      b_int := rand.Intn(128)
+      c_int := a_int + b_int
+      expect := prepareSequence(c_int, 0).Window(0, 0, 8, 1)
+      out := n.Predict(prepareSequence(a_int, b_int))
+      n.Learn(out, expect).Update(0.02)
+      if c_int != decodeSequence(out) {
+         error ++
+      }
+
+      if i % 1000 == 0 {
+         fmt.Printf("error: %.2f%%\n", float64(error)/1000.0 * 100.0)
+         error = 0
+         fmt.Println(a_int, " + ", b_int, " = ", c_int, "  [A]", decodeSequence(out))
+      }
+   }
+
+   error = 0
+   n.EvalMode()
+   for i := 1; i <= 20000; i++ {
+      a_int := rand.Intn(128)
+      b_int := rand.Intn(128)
+      c_int := a_int + b_int
+      if c_int != decodeSequence(n.PredictSafe(prepareSequence(a_int, b_int))) {
+         error ++
+      }
+   }
+   fmt.Printf("Test Error: %.2f%%\n", float64(error)/20000.0 * 100.0)
+}
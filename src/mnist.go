@@ -77,12 +77,12 @@ func mnist (dataset *MNISTDataset) {
       /* 28*28 pixels */ 28, 28,
       /* 5*5 kernel */ 5, 5,
       /* decay */ 0.001))
-   n.AddLayer(nn.NewLayerActivation(1* 28, 12 * 28, "tanh"))
+   n.AddLayer(nn.MustLayerActivation(1* 28, 12 * 28, "tanh"))
    n.AddLayer(nn.NewLayerPoolMax(1, 12, 28, 28, 2, 2))
    n.AddLayer(nn.NewLayerConvolution(1, 12, 16, 14, 14, 5, 5, 0.001))
-   n.AddLayer(nn.NewLayerActivation(1 * 14, 16 * 14, "tanh"))
+   n.AddLayer(nn.MustLayerActivation(1 * 14, 16 * 14, "tanh"))
    n.AddLayer(nn.NewLayerFlatten(1 * 14, 16 * 14))
-   n.AddLayer(nn.NewLayerLinear(1, 16 * 14 * 14, 10, 0.5, 0, true))
+   n.AddLayer(nn.NewLayerLinear(1, 16 * 14 * 14, 10, 0, true))
    n.AddLayer(nn.NewLayerLogRegression(1, 10))
 
    error := 0
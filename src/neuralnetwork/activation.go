@@ -0,0 +1,163 @@
+package neuralnetwork
+
+import (
+   "fmt"
+   "math"
+)
+
+// Activation function f(x; a) with an optional parameter a (e.g. the negative
+// slope of leaky ReLU). Derivative is df/dx; it receives both the input x and
+// the output y = f(x; a) so every function can be derived on whichever argument
+// is correct (and cheapest) for it. ParamDerivative is df/da and is set only
+// when a is learnable.
+type Activation struct {
+   Name string
+   Fun func (x, a float64) float64
+   Derivative func (x, y, a float64) float64
+   ParamDerivative func (x, y, a float64) float64
+   Param float64
+}
+
+var activations = make(map[string]*Activation)
+
+func RegisterActivation (act *Activation) {
+   activations[act.Name] = act
+}
+
+func LookupActivation (name string) (*Activation, error) {
+   act, ok := activations[name]
+   if !ok {
+      return nil, fmt.Errorf("neuralnetwork: unknown activation %q", name)
+   }
+   return act, nil
+}
+
+func ActivationNames () []string {
+   r := make([]string, 0, len(activations))
+   for name := range activations {
+      r = append(r, name)
+   }
+   return r
+}
+
+const (
+   seluLambda = 1.0507009873554805
+   seluAlpha  = 1.6732632423543772
+)
+
+func init () {
+   RegisterActivation(&Activation{
+      Name: "identity",
+      Fun: func (x, a float64) float64 { return x },
+      Derivative: func (x, y, a float64) float64 { return 1 },
+   })
+   RegisterActivation(&Activation{
+      Name: "sigmoid",
+      Fun: func (x, a float64) float64 { return Sigmoid(x) },
+      Derivative: func (x, y, a float64) float64 { return y * (1 - y) },
+   })
+   RegisterActivation(&Activation{
+      Name: "hard_sigmoid",
+      Fun: func (x, a float64) float64 { return math.Max(0, math.Min(1, 0.2 * x + 0.5)) },
+      Derivative: func (x, y, a float64) float64 {
+         if x > -2.5 && x < 2.5 {
+            return 0.2
+         }
+         return 0
+      },
+   })
+   RegisterActivation(&Activation{
+      Name: "tanh",
+      Fun: func (x, a float64) float64 { return Tanh(x) },
+      Derivative: func (x, y, a float64) float64 { return 1 - y * y },
+   })
+   RegisterActivation(&Activation{
+      Name: "relu",
+      Fun: func (x, a float64) float64 { return Relu(x) },
+      Derivative: func (x, y, a float64) float64 { return ReluDerivative(x) },
+   })
+   RegisterActivation(&Activation{
+      Name: "leaky_relu",
+      Fun: __leaky_relu__,
+      Derivative: __leaky_relu_derivative__,
+      Param: 0.01,
+   })
+   RegisterActivation(&Activation{
+      Name: "prelu",
+      Fun: __leaky_relu__,
+      Derivative: __leaky_relu_derivative__,
+      ParamDerivative: func (x, y, a float64) float64 {
+         if x > 0 {
+            return 0
+         }
+         return x
+      },
+      Param: 0.25,
+   })
+   RegisterActivation(&Activation{
+      Name: "elu",
+      Fun: func (x, a float64) float64 {
+         if x > 0 {
+            return x
+         }
+         return a * (math.Exp(x) - 1)
+      },
+      Derivative: func (x, y, a float64) float64 {
+         if x > 0 {
+            return 1
+         }
+         return y + a
+      },
+      Param: 1.0,
+   })
+   RegisterActivation(&Activation{
+      Name: "selu",
+      Fun: func (x, a float64) float64 {
+         if x > 0 {
+            return seluLambda * x
+         }
+         return seluLambda * seluAlpha * (math.Exp(x) - 1)
+      },
+      Derivative: func (x, y, a float64) float64 {
+         if x > 0 {
+            return seluLambda
+         }
+         return seluLambda * seluAlpha * math.Exp(x)
+      },
+   })
+   RegisterActivation(&Activation{
+      Name: "gelu",
+      // exact form: x * Phi(x)
+      Fun: func (x, a float64) float64 { return x * 0.5 * (1 + math.Erf(x / math.Sqrt2)) },
+      Derivative: func (x, y, a float64) float64 {
+         return 0.5 * (1 + math.Erf(x / math.Sqrt2)) + x * math.Exp(-x * x / 2) / math.Sqrt(2 * math.Pi)
+      },
+   })
+   RegisterActivation(&Activation{
+      Name: "softplus",
+      Fun: func (x, a float64) float64 { return math.Max(x, 0) + math.Log1p(math.Exp(-math.Abs(x))) },
+      Derivative: func (x, y, a float64) float64 { return Sigmoid(x) },
+   })
+   RegisterActivation(&Activation{
+      Name: "swish",
+      Fun: func (x, a float64) float64 { return x * Sigmoid(x) },
+      Derivative: func (x, y, a float64) float64 {
+         s := Sigmoid(x)
+         return s + x * s * (1 - s)
+      },
+   })
+}
+
+func __leaky_relu__ (x, a float64) float64 {
+   if x > 0 {
+      return x
+   }
+   return a * x
+}
+
+func __leaky_relu_derivative__ (x, y, a float64) float64 {
+   if x > 0 {
+      return 1
+   }
+   return a
+}
@@ -0,0 +1,49 @@
+package neuralnetwork
+
+import (
+   "math"
+   "sort"
+   "testing"
+)
+
+// Derivative and ParamDerivative of every registered activation against
+// central differences, away from the kinks at 0 and +-2.5 (hard_sigmoid).
+func TestActivationDerivatives (t *testing.T) {
+   names := ActivationNames()
+   sort.Strings(names)
+   h := 1e-6
+   for _, name := range names {
+      act, _ := LookupActivation(name)
+      for _, x := range []float64{-3.1, -1.7, -0.6, -0.05, 0.05, 0.8, 1.9, 3.3} {
+         a := act.Param
+         y := act.Fun(x, a)
+         numeric := (act.Fun(x + h, a) - act.Fun(x - h, a)) / (2 * h)
+         if d := act.Derivative(x, y, a); math.Abs(d - numeric) > 1e-6 {
+            t.Errorf("%s'(%v) = %v, numeric %v", name, x, d, numeric)
+         }
+         if act.ParamDerivative == nil {
+            continue
+         }
+         numeric = (act.Fun(x, a + h) - act.Fun(x, a - h)) / (2 * h)
+         if d := act.ParamDerivative(x, y, a); math.Abs(d - numeric) > 1e-6 {
+            t.Errorf("d%s/da(%v) = %v, numeric %v", name, x, d, numeric)
+         }
+      }
+   }
+}
+
+// The learnable slope of a PReLU layer gets the delta of the chain.
+func TestLayerActivationPReLUDelta (t *testing.T) {
+   prelu := MustLayerActivation(1, 3, "prelu")
+   n := NewNeuralChain()
+   n.AddLayer(NewLayerLinear(1, 2, 3, 0, false))
+   n.AddLayer(prelu)
+   n.Seed(3)
+   input := NewSimpleMatrix(1, 2).FillElt([]float64{0.9, -1.2})
+   expect := NewSimpleMatrix(1, 3).FillElt([]float64{0.5, -0.5, 0.2})
+   n.Learn(n.Predict(input), expect)
+   if prelu.Delta()[0].Data[0][0] == 0 {
+      t.Fatal("no negative input reaches the slope")
+   }
+   checkTestDelta(t, "prelu a", prelu.Param, prelu.Delta()[0], testChainLoss(n, input, expect, nil))
+}
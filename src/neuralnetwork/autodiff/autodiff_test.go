@@ -0,0 +1,137 @@
+package autodiff
+
+import (
+   "math"
+   "testing"
+
+   nn "neuralnetwork"
+)
+
+func mustActivation (name string) *nn.Activation {
+   fun, err := nn.LookupActivation(name)
+   if err != nil {
+      panic(err)
+   }
+   return fun
+}
+
+// f(A, B) = sum(C * softmax(concat(tanh(A.B), window(A*A + B, ...)).reshape))
+func testExpression (A, B *Variable) *Variable {
+   tanh := mustActivation("tanh")
+   left := A.Dot(B).Map(tanh)                               // 2 * 2
+   right := A.Window(0, 1, 2, 2).EltMul(B.Window(-1, 0, 2, 2)).Add(left, 1, -0.5)
+   return left.ConnectRight(right).Reshape(1, 8).Softmax().Scale(3)
+}
+
+func TestVariableGradient (t *testing.T) {
+   random := nn.NewRand(1)
+   A0 := random.FillRandom(nn.NewSimpleMatrix(2, 3), -1, 1)
+   B0 := random.FillRandom(nn.NewSimpleMatrix(3, 2), -1, 1)
+   C := random.FillRandom(nn.NewSimpleMatrix(1, 8), -1, 1)
+   f := func () float64 {
+      tape := NewTape()
+      return testExpression(tape.Var(A0), tape.Var(B0)).Value.EltMul(C).EltSum()
+   }
+
+   tape := NewTape()
+   A := tape.Var(A0)
+   B := tape.Var(B0)
+   tape.Backward(testExpression(A, B), C)
+   h := 1e-6
+   for _, v := range []*Variable{A, B} {
+      for i := range v.Value.Data {
+         for j := range v.Value.Data[i] {
+            x := v.Value.Data[i][j]
+            v.Value.Data[i][j] = x + h
+            fp := f()
+            v.Value.Data[i][j] = x - h
+            fm := f()
+            v.Value.Data[i][j] = x
+            numeric := (fp - fm) / (2 * h)
+            if math.Abs(numeric - v.Grad.Data[i][j]) > 1e-7 {
+               t.Fatalf("[%d][%d]: %v != %v", i, j, v.Grad.Data[i][j], numeric)
+            }
+         }
+      }
+   }
+}
+
+func TestLayerFuncInChain (t *testing.T) {
+   random := nn.NewRand(2)
+   sigmoid := mustActivation("sigmoid")
+   layer := NewLayerFunc(1, 3, 1, 2, func (x *Variable, p []*Variable) *Variable {
+      return x.Dot(p[0]).Add(p[1], 1, 1).Map(sigmoid)
+   }, random.FillRandom(nn.NewSimpleMatrix(3, 2), -1, 1), nn.NewSimpleMatrix(1, 2))
+   n := nn.NewNeuralChain()
+   n.AddLayer(nn.NewLayerLinear(1, 2, 3, 0, false))
+   n.AddLayer(layer)
+   n.Seed(3)
+
+   input := nn.NewSimpleMatrix(1, 2).FillElt([]float64{0.4, -0.9})
+   expect := nn.NewSimpleMatrix(1, 2).FillElt([]float64{1, 0})
+   loss := func () float64 {
+      d := expect.Add(n.Predict(input), 1, -1)
+      return 0.5 * d.EltMul(d).EltSum()
+   }
+   n.Learn(n.Predict(input), expect)
+   delta := layer.Delta()
+   h := 1e-6
+   params := layer.Params()
+   if len(params) != len(delta) || params[0].Name != "param0" {
+      t.Fatal(params)
+   }
+   if grads := n.Grads(); grads[len(grads) - 1].Name != "layer1.param1" || grads[len(grads) - 1].Value != delta[1] {
+      t.Error("deltas not named after the parameters in the chain")
+   }
+   for k, named := range params {
+      P := named.Value
+      for i := range P.Data {
+         for j := range P.Data[i] {
+            x := P.Data[i][j]
+            P.Data[i][j] = x + h
+            lp := loss()
+            P.Data[i][j] = x - h
+            lm := loss()
+            P.Data[i][j] = x
+            // deltas are negative gradients
+            numeric := -(lp - lm) / (2 * h)
+            if math.Abs(numeric - delta[k].Data[i][j]) > 1e-7 {
+               t.Fatalf("param %d [%d][%d]: %v != %v", k, i, j, delta[k].Data[i][j], numeric)
+            }
+         }
+      }
+   }
+
+   before := loss()
+   for i := 0; i < 50; i++ {
+      n.Fit(input, expect, 0.5)
+   }
+   if loss() >= before {
+      t.Fail()
+   }
+}
+
+func TestLayerLinearMatchesLayerFunc (t *testing.T) {
+   linear := nn.NewLayerLinear(2, 3, 2, 0.1, true, nn.NewUniformInitializer(-1, 1))
+   linear.B.FillElt([]float64{0.1, -0.2, 0.3, 0.4})
+   decay := 0.1
+   layer := NewLayerFunc(2, 3, 2, 2, func (x *Variable, p []*Variable) *Variable {
+      return x.Dot(p[0]).Add(p[1], 1, 1)
+   }, linear.W.Clone(), linear.B.Clone())
+
+   input := nn.NewSimpleMatrix(2, 3).FillElt([]float64{0.5, -1, 2, 0.3, 0.7, -0.4})
+   grad := nn.NewSimpleMatrix(2, 2).FillElt([]float64{1, -0.5, 0.25, 2})
+   a := linear.ForwardProp(input)
+   b := layer.ForwardProp(input)
+   ga := linear.BackwardProp(grad)
+   gb := layer.BackwardProp(grad)
+   // weight decay is added to the W delta of LayerLinear only
+   delta := layer.Delta()
+   delta[0] = delta[0].Add(linear.W.Scale(decay), 1, 1)
+   pairs := [][2]*nn.SimpleMatrix{{a, b}, {ga, gb}, {linear.Delta()[0], delta[0]}, {linear.Delta()[1], delta[1]}}
+   for k, pair := range pairs {
+      if pair[0].Add(pair[1], 1, -1).Map(math.Abs).EltMax() > 1e-12 {
+         t.Errorf("pair %d differs", k)
+      }
+   }
+}
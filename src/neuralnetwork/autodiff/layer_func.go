@@ -0,0 +1,124 @@
+package autodiff
+
+import (
+   "fmt"
+
+   nn "neuralnetwork"
+)
+
+// Forward pass of a LayerFunc: params are Variables of LayerFunc.Params() in
+// the same order.
+type ForwardFunc func (input *Variable, params []*Variable) *Variable
+
+// Adapter from a forward pass to nn.Layer: BackwardProp and the parameter
+// deltas come from the tape. Since the chain passes negative gradients
+// (expect - predict), the deltas are negative gradients as for every other
+// layer and ParamsUpdate adds alpha * delta.
+type LayerFunc struct {
+   nn.LayerBase
+   params []*nn.SimpleMatrix
+   DeltaParams []*nn.SimpleMatrix
+   Forward ForwardFunc
+   InputM, InputN, OutputM, OutputN int
+   input, output *Variable
+   vars []*Variable
+   tape *Tape
+   lastGrad *nn.SimpleMatrix
+}
+
+func NewLayerFunc (
+   input_m, input_n, output_m, output_n int,
+   forward ForwardFunc, params ...*nn.SimpleMatrix,
+) *LayerFunc {
+   c := new(LayerFunc)
+   c.InputM = input_m
+   c.InputN = input_n
+   c.OutputM = output_m
+   c.OutputN = output_n
+   c.Forward = forward
+   c.params = params
+   c.DeltaParams = make([]*nn.SimpleMatrix, len(params))
+   for i, P := range params {
+      c.DeltaParams[i] = nn.NewSimpleMatrix(P.M, P.N)
+   }
+   return c
+}
+
+func (c *LayerFunc) OutputDim () (int, int) {
+   return c.OutputM, c.OutputN
+}
+
+func (c *LayerFunc) InputDim () (int, int) {
+   return c.InputM, c.InputN
+}
+
+func (c *LayerFunc) run (input *nn.SimpleMatrix) (*Tape, *Variable, []*Variable, *Variable) {
+   tape := NewTape()
+   x := tape.Var(input)
+   vars := make([]*Variable, len(c.params))
+   for i, P := range c.params {
+      vars[i] = tape.Var(P)
+   }
+   return tape, x, vars, c.Forward(x, vars)
+}
+
+func (c *LayerFunc) ForwardProp (input *nn.SimpleMatrix) *nn.SimpleMatrix {
+   c.tape, c.input, c.vars, c.output = c.run(input.Clone())
+   c.LoadLastInput(c.input.Value)
+   c.LoadLastOutput(c.output.Value)
+   return c.output.Value.Clone()
+}
+
+func (c *LayerFunc) Infer (ctx *nn.InferContext, input *nn.SimpleMatrix) *nn.SimpleMatrix {
+   _, _, _, output := c.run(input)
+   return output.Value.Clone()
+}
+
+func (c *LayerFunc) BackwardProp (output_grad *nn.SimpleMatrix) *nn.SimpleMatrix {
+   c.tape.Backward(c.output, output_grad)
+   for i, P := range c.vars {
+      if P.Grad == nil {
+         c.DeltaParams[i] = nn.NewSimpleMatrix(P.Value.M, P.Value.N)
+      } else {
+         c.DeltaParams[i] = P.Grad
+      }
+   }
+   c.lastGrad = c.input.Grad
+   if c.lastGrad == nil {
+      c.lastGrad = nn.NewSimpleMatrix(c.input.Value.M, c.input.Value.N)
+   }
+   return c.lastGrad.Clone()
+}
+
+func (c *LayerFunc) LastGrad () *nn.SimpleMatrix {
+   return c.lastGrad
+}
+
+// Parameters named "param<index>" in the order of NewLayerFunc.
+func (c *LayerFunc) Params () []nn.NamedMatrix {
+   r := make([]nn.NamedMatrix, len(c.params))
+   for i, P := range c.params {
+      r[i] = nn.NamedMatrix{Name: fmt.Sprintf("param%d", i), Value: P}
+   }
+   return r
+}
+
+func (c *LayerFunc) DeltaN () int {
+   return len(c.params)
+}
+
+func (c *LayerFunc) Delta () []*nn.SimpleMatrix {
+   return c.DeltaParams
+}
+
+func (c *LayerFunc) CorrectDelta (delta []*nn.SimpleMatrix, offset int) {
+   for i := range c.DeltaParams {
+      c.DeltaParams[i] = delta[offset + i]
+   }
+}
+
+func (c *LayerFunc) ParamsUpdate (alpha float64) {
+   for i, P := range c.params {
+      c.params[i] = P.Add(c.DeltaParams[i], 1, alpha)
+   }
+}
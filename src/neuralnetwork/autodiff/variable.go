@@ -0,0 +1,155 @@
+package autodiff
+
+import (
+   nn "neuralnetwork"
+)
+
+// Tape-based reverse-mode differentiation over nn.SimpleMatrix. Every
+// operation on a Variable appends its backward step to the tape of its
+// operands; Backward replays the tape in reverse order and accumulates the
+// gradient of every Variable into Grad.
+type Tape struct {
+   vars []*Variable
+   steps []func ()
+}
+
+func NewTape () *Tape {
+   return new(Tape)
+}
+
+type Variable struct {
+   Value *nn.SimpleMatrix
+   // nil until Backward reaches the variable
+   Grad *nn.SimpleMatrix
+   tape *Tape
+}
+
+// New leaf (input or parameter) on the tape.
+func (t *Tape) Var (X *nn.SimpleMatrix) *Variable {
+   return t.add(X)
+}
+
+func (t *Tape) add (X *nn.SimpleMatrix) *Variable {
+   v := &Variable{Value: X, tape: t}
+   t.vars = append(t.vars, v)
+   return v
+}
+
+// Seed out with grad (the gradient of some scalar w.r.t. out; a matrix of
+// ones when out itself is the scalar) and propagate it to every Variable.
+// Gradients of a previous Backward on the tape are discarded.
+func (t *Tape) Backward (out *Variable, grad *nn.SimpleMatrix) {
+   for _, v := range t.vars {
+      v.Grad = nil
+   }
+   out.accumulate(grad)
+   for i := len(t.steps) - 1; i >= 0; i-- {
+      t.steps[i]()
+   }
+}
+
+func (x *Variable) accumulate (grad *nn.SimpleMatrix) {
+   if x.Grad == nil {
+      x.Grad = grad.Clone()
+   } else {
+      x.Grad = x.Grad.Add(grad, 1, 1)
+   }
+}
+
+func (x *Variable) record (value *nn.SimpleMatrix, backward func (r *Variable)) *Variable {
+   r := x.tape.add(value)
+   x.tape.steps = append(x.tape.steps, func () {
+      if r.Grad != nil {
+         backward(r)
+      }
+   })
+   return r
+}
+
+func (x *Variable) Dot (y *Variable) *Variable {
+   return x.record(x.Value.Dot(y.Value), func (r *Variable) {
+      x.accumulate(r.Grad.Dot(y.Value.T()))
+      y.accumulate(x.Value.T().Dot(r.Grad))
+   })
+}
+
+// a1 * x + a2 * y, like SimpleMatrix.Add
+func (x *Variable) Add (y *Variable, a1, a2 float64) *Variable {
+   return x.record(x.Value.Add(y.Value, a1, a2), func (r *Variable) {
+      x.accumulate(r.Grad.Scale(a1))
+      y.accumulate(r.Grad.Scale(a2))
+   })
+}
+
+func (x *Variable) Scale (a float64) *Variable {
+   return x.record(x.Value.Scale(a), func (r *Variable) {
+      x.accumulate(r.Grad.Scale(a))
+   })
+}
+
+func (x *Variable) EltMul (y *Variable) *Variable {
+   return x.record(x.Value.EltMul(y.Value), func (r *Variable) {
+      x.accumulate(r.Grad.EltMul(y.Value))
+      y.accumulate(r.Grad.EltMul(x.Value))
+   })
+}
+
+// Element-wise activation; the derivative is the one registered with fun
+// (see nn.RegisterActivation), evaluated at fun.Param.
+func (x *Variable) Map (fun *nn.Activation) *Variable {
+   a := fun.Param
+   value := x.Value.Map(func (v float64) float64 {
+      return fun.Fun(v, a)
+   })
+   return x.record(value, func (r *Variable) {
+      grad := nn.NewSimpleMatrix(r.Grad.M, r.Grad.N)
+      for i := grad.M - 1; i >= 0; i-- {
+         for j := grad.N - 1; j >= 0; j-- {
+            grad.Data[i][j] = r.Grad.Data[i][j] * fun.Derivative(x.Value.Data[i][j], value.Data[i][j], a)
+         }
+      }
+      x.accumulate(grad)
+   })
+}
+
+// Softmax over all elements, like SimpleMatrix.Softmax.
+func (x *Variable) Softmax () *Variable {
+   value := x.Value.Softmax()
+   return x.record(value, func (r *Variable) {
+      // dx = y * (g - sum(g * y))
+      s := r.Grad.EltMul(value).EltSum()
+      x.accumulate(r.Grad.Map(func (g float64) float64 {
+         return g - s
+      }).EltMul(value))
+   })
+}
+
+func (x *Variable) Reshape (m, n int) *Variable {
+   return x.record(x.Value.Reshape(m, n), func (r *Variable) {
+      x.accumulate(r.Grad.Reshape(x.Value.M, x.Value.N))
+   })
+}
+
+// Window of x like SimpleMatrix.Window; cells out of x are zero and get no
+// gradient.
+func (x *Variable) Window (y, z, h, w int) *Variable {
+   return x.record(x.Value.Window(y, z, h, w), func (r *Variable) {
+      grad := nn.NewSimpleMatrix(x.Value.M, x.Value.N)
+      for i := h - 1; i >= 0; i-- {
+         for j := w - 1; j >= 0; j-- {
+            if i + y < 0 || i + y >= grad.M || j + z < 0 || j + z >= grad.N {
+               continue
+            }
+            grad.Data[i + y][j + z] = r.Grad.Data[i][j]
+         }
+      }
+      x.accumulate(grad)
+   })
+}
+
+func (x *Variable) ConnectRight (y *Variable) *Variable {
+   return x.record(x.Value.ConnectRight(y.Value), func (r *Variable) {
+      x.accumulate(r.Grad.Window(0, 0, x.Value.M, x.Value.N))
+      y.accumulate(r.Grad.Window(0, x.Value.N, y.Value.M, y.Value.N))
+   })
+}
@@ -0,0 +1,50 @@
+package neuralnetwork
+
+import (
+   "fmt"
+   "math"
+   "testing"
+)
+
+// Compare delta with the numeric negative gradient of loss with respect to
+// every element of W; loss must be computed from the current W.
+func checkTestDelta (t *testing.T, name string, W, delta *SimpleMatrix, loss func () float64) {
+   t.Helper()
+   delta = delta.Clone()
+   h := 1e-6
+   for i := range W.Data {
+      for j := range W.Data[i] {
+         w := W.Data[i][j]
+         W.Data[i][j] = w + h
+         lp := loss()
+         W.Data[i][j] = w - h
+         lm := loss()
+         W.Data[i][j] = w
+         // Delta is the negative gradient
+         numeric := -(lp - lm) / (2 * h)
+         if math.Abs(numeric - delta.Data[i][j]) > 1e-6 {
+            t.Fatalf("%s[%d][%d]: %v != %v", name, i, j, delta.Data[i][j], numeric)
+         }
+      }
+   }
+}
+
+// 0.5 * |expect - n(input)|^2 under the padding mask, nil for none
+func testChainLoss (n *NeuralChain, input, expect, mask *SimpleMatrix) func () float64 {
+   return func () float64 {
+      d := expect.Add(n.Infer(NewInferContext().SetMask(mask), input), 1, -1)
+      return 0.5 * d.EltMul(d).EltSum()
+   }
+}
+
+// Compare the delta of every W in linears with the numeric negative gradient
+// of testChainLoss.
+func checkTestLinearDelta (t *testing.T, n *NeuralChain, linears []*LayerLinear, input, expect, mask *SimpleMatrix) {
+   t.Helper()
+   n.SetMask(mask)
+   n.Learn(n.Predict(input), expect)
+   loss := testChainLoss(n, input, expect, mask)
+   for k, layer := range linears {
+      checkTestDelta(t, fmt.Sprintf("linear %d W", k), layer.W, layer.Delta()[0], loss)
+   }
+}
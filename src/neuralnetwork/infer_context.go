@@ -0,0 +1,59 @@
+package neuralnetwork
+
+import "sync"
+
+// Per-call state of a stateless inference pass (see InferLayer); one context
+// belongs to one call, so a trained chain can serve many goroutines. For a
+// recurrent chain a context is one sequence: reuse it for every step.
+type InferContext struct {
+   // replicas of the layers without a stateless path, run with ForwardProp;
+   // nil for a layer without a replica
+   scratch map[Layer]Layer
+   // latest record (e.g. hidden state) of every recurrent layer
+   records map[*LayerRecordShadow]*SimpleMatrix
+   // padding mask of the sequence of this call, see MaskLayer
+   mask *SimpleMatrix
+}
+
+func NewInferContext () *InferContext {
+   ctx := new(InferContext)
+   ctx.scratch = make(map[Layer]Layer)
+   ctx.records = make(map[*LayerRecordShadow]*SimpleMatrix)
+   return ctx
+}
+
+// Padding mask of the attention layers for this call; the masks set on the
+// layers are for training only, so that calls with different padding do not
+// share one. nil for none.
+func (ctx *InferContext) SetMask (mask *SimpleMatrix) *InferContext {
+   ctx.mask = mask
+   return ctx
+}
+
+// layers without a stateless path or a replica run on themselves, one call
+// at a time; Layer -> *sync.Mutex
+var infer_fallback_locks sync.Map
+
+// Infer, or ForwardProp on a replica owned by ctx for layers that are not an
+// InferLayer. A layer that is neither runs on itself under a lock of its own,
+// so concurrent calls wait for each other instead of racing.
+func InferLayerOf (ctx *InferContext, layer Layer, input *SimpleMatrix) *SimpleMatrix {
+   if l, ok := layer.(InferLayer); ok {
+      return l.Infer(ctx, input)
+   }
+   scratch, ok := ctx.scratch[layer]
+   if !ok {
+      var err error
+      if scratch, err = ReplicaOf(layer); err != nil {
+         scratch = nil
+      }
+      ctx.scratch[layer] = scratch
+   }
+   if scratch == nil {
+      lock, _ := infer_fallback_locks.LoadOrStore(layer, new(sync.Mutex))
+      lock.(*sync.Mutex).Lock()
+      defer lock.(*sync.Mutex).Unlock()
+      return layer.ForwardProp(input)
+   }
+   return scratch.ForwardProp(input)
+}
@@ -0,0 +1,129 @@
+package neuralnetwork
+
+import (
+   "sync"
+   "testing"
+)
+
+func TestNeuralChainPredictSafeConcurrent (t *testing.T) {
+   n := NewNeuralChain()
+   n.AddLayer(NewLayerConvolution(1, 1, 2, 6, 6, 3, 3, 0))
+   n.AddLayer(MustLayerActivation(6, 12, "relu"))
+   n.AddLayer(NewLayerPoolMax(1, 2, 6, 6, 2, 2))
+   n.AddLayer(NewLayerFlatten(3, 6))
+   n.AddLayer(NewLayerBatchNorm(1, 18, 0.9))
+   n.AddLayer(NewLayerDropout(1, 18, 0.5, 0))
+   inner := NewNeuralChain()
+   inner.AddLayer(NewLayerLinear(1, 18, 4, 0, false))
+   inner.AddLayer(NewLayerLayerNorm(1, 4))
+   n.AddLayer(NewLayerShadow(inner))
+   n.AddLayer(NewLayerLogRegression(1, 4))
+   n.Seed(1).EvalMode()
+
+   inputs := make([]*SimpleMatrix, 16)
+   expects := make([]*SimpleMatrix, len(inputs))
+   for i := range inputs {
+      inputs[i] = n.Rand.FillRandom(NewSimpleMatrix(6, 6), -1, 1)
+      expects[i] = n.Predict(inputs[i])
+   }
+
+   var wg sync.WaitGroup
+   failed := make([]bool, 8)
+   for g := range failed {
+      wg.Add(1)
+      go func (g int) {
+         defer wg.Done()
+         for round := 0; round < 10; round++ {
+            for i, input := range inputs {
+               output := n.PredictSafe(input)
+               if output.Add(expects[i], 1, -1).Map(func (x float64) float64 { return x * x }).EltSum() > epsilon {
+                  failed[g] = true
+               }
+            }
+         }
+      }(g)
+   }
+   wg.Wait()
+   for _, f := range failed {
+      if f {
+         t.Fail()
+      }
+   }
+}
+
+// A layer without Infer: ForwardProp goes through a field.
+type testForwardOnlyLayer struct {
+   LayerBase
+   buffer *SimpleMatrix
+}
+
+func (c *testForwardOnlyLayer) ForwardProp (input *SimpleMatrix) *SimpleMatrix {
+   c.buffer = input.Scale(2)
+   return c.buffer.Clone()
+}
+
+func (c *testForwardOnlyLayer) Replica () (Layer, error) {
+   return new(testForwardOnlyLayer), nil
+}
+
+// Layers without a stateless path run on replicas of the context.
+func TestInferContextScratchReplica (t *testing.T) {
+   layer := new(testForwardOnlyLayer)
+   n := NewNeuralChain()
+   n.AddLayer(layer)
+   n.AddLayer(NewLayerShadow(layer))
+   input := NewSimpleMatrix(1, 3).Fill(1)
+
+   var wg sync.WaitGroup
+   for g := 0; g < 8; g++ {
+      wg.Add(1)
+      go func () {
+         defer wg.Done()
+         ctx := NewInferContext()
+         for round := 0; round < 10; round++ {
+            if n.Infer(ctx, input).EltSum() != 12 {
+               t.Error("wrong output")
+            }
+         }
+         if len(ctx.scratch) != 1 {
+            t.Errorf("%d replicas", len(ctx.scratch))
+         }
+      }()
+   }
+   wg.Wait()
+   if layer.buffer != nil {
+      t.Error("inference ran on the layer itself")
+   }
+}
+
+// A layer without Infer or Replica: ForwardProp reads back its own field.
+type testSharedOnlyLayer struct {
+   LayerBase
+   buffer *SimpleMatrix
+}
+
+func (c *testSharedOnlyLayer) ForwardProp (input *SimpleMatrix) *SimpleMatrix {
+   c.buffer = input.Scale(2)
+   return c.buffer.Clone()
+}
+
+// Without a replica, calls on the layer itself are serialized (go test -race).
+func TestInferContextSharedFallback (t *testing.T) {
+   layer := new(testSharedOnlyLayer)
+   n := NewNeuralChain()
+   n.AddLayer(layer)
+   var wg sync.WaitGroup
+   for g := 0; g < 8; g++ {
+      wg.Add(1)
+      go func (g int) {
+         defer wg.Done()
+         input := NewSimpleMatrix(1, 3).Fill(float64(g))
+         for round := 0; round < 20; round++ {
+            if n.PredictSafe(input).EltSum() != float64(6 * g) {
+               t.Error("output of another call")
+            }
+         }
+      }(g)
+   }
+   wg.Wait()
+}
@@ -0,0 +1,204 @@
+package neuralnetwork
+
+import "math"
+
+// ref: http://proceedings.mlr.press/v9/glorot10a (Xavier/Glorot)
+//      https://arxiv.org/abs/1502.01852 (He/Kaiming)
+//      https://arxiv.org/abs/1312.6120 (orthogonal)
+
+type Initializer interface {
+   // Fill W of a layer with the given fan-in and fan-out and return it.
+   Initialize (W *SimpleMatrix, fan_in, fan_out int) *SimpleMatrix
+}
+
+type RandomInitializer interface {
+   Initializer
+   SetRand (r *Rand)
+}
+
+// Rand of a random initializer; the default Rand is used until SetRand.
+type initializerRand struct {
+   Rand *Rand
+}
+
+func (h *initializerRand) SetRand (r *Rand) {
+   h.Rand = r
+}
+
+func (h *initializerRand) random () *Rand {
+   return __rand_or_default__(h.Rand)
+}
+
+func __initializer_pick__ (initializer []Initializer, fallback Initializer) Initializer {
+   if len(initializer) > 0 && initializer[0] != nil {
+      return initializer[0]
+   }
+   return fallback
+}
+
+// Redraw W with initializer, bound to r when it is random.
+func __initializer_redraw__ (initializer Initializer, r *Rand, W *SimpleMatrix, fan_in, fan_out int) *SimpleMatrix {
+   if ri, ok := initializer.(RandomInitializer); ok {
+      ri.SetRand(r)
+   }
+   return initializer.Initialize(W, fan_in, fan_out)
+}
+
+
+type ConstantInitializer struct {
+   Value float64
+}
+
+func NewConstantInitializer (value float64) *ConstantInitializer {
+   return &ConstantInitializer{Value: value}
+}
+
+func NewZeroInitializer () *ConstantInitializer {
+   return NewConstantInitializer(0)
+}
+
+func (r *ConstantInitializer) Initialize (W *SimpleMatrix, fan_in, fan_out int) *SimpleMatrix {
+   return W.Fill(r.Value)
+}
+
+
+type UniformInitializer struct {
+   initializerRand
+   Low, High float64
+}
+
+func NewUniformInitializer (low, high float64) *UniformInitializer {
+   return &UniformInitializer{Low: low, High: high}
+}
+
+func (r *UniformInitializer) Initialize (W *SimpleMatrix, fan_in, fan_out int) *SimpleMatrix {
+   return r.random().FillRandom(W, r.Low, r.High)
+}
+
+
+type NormalInitializer struct {
+   initializerRand
+   Mean, Std float64
+}
+
+func NewNormalInitializer (mean, std float64) *NormalInitializer {
+   return &NormalInitializer{Mean: mean, Std: std}
+}
+
+func (r *NormalInitializer) Initialize (W *SimpleMatrix, fan_in, fan_out int) *SimpleMatrix {
+   return r.random().FillGaussian(W, r.Mean, r.Std)
+}
+
+
+// Xavier/Glorot: Var(W) = gain^2 * 2 / (fan_in + fan_out); suits tanh/sigmoid.
+type XavierInitializer struct {
+   initializerRand
+   Gain float64
+   Uniform bool
+}
+
+func NewXavierUniform (gain float64) *XavierInitializer {
+   return &XavierInitializer{Gain: gain, Uniform: true}
+}
+
+func NewXavierNormal (gain float64) *XavierInitializer {
+   return &XavierInitializer{Gain: gain}
+}
+
+func (r *XavierInitializer) Initialize (W *SimpleMatrix, fan_in, fan_out int) *SimpleMatrix {
+   return __initializer_variance__(r.random(), W, r.Uniform, r.Gain * r.Gain * 2 / float64(fan_in + fan_out))
+}
+
+
+// He/Kaiming: Var(W) = 2 / fan_in; suits the ReLU family.
+type HeInitializer struct {
+   initializerRand
+   Uniform bool
+}
+
+func NewHeUniform () *HeInitializer {
+   return &HeInitializer{Uniform: true}
+}
+
+func NewHeNormal () *HeInitializer {
+   return &HeInitializer{}
+}
+
+func (r *HeInitializer) Initialize (W *SimpleMatrix, fan_in, fan_out int) *SimpleMatrix {
+   return __initializer_variance__(r.random(), W, r.Uniform, 2 / float64(fan_in))
+}
+
+
+// LeCun: Var(W) = 1 / fan_in; suits SELU.
+type LeCunInitializer struct {
+   initializerRand
+   Uniform bool
+}
+
+func NewLeCunUniform () *LeCunInitializer {
+   return &LeCunInitializer{Uniform: true}
+}
+
+func NewLeCunNormal () *LeCunInitializer {
+   return &LeCunInitializer{}
+}
+
+func (r *LeCunInitializer) Initialize (W *SimpleMatrix, fan_in, fan_out int) *SimpleMatrix {
+   return __initializer_variance__(r.random(), W, r.Uniform, 1 / float64(fan_in))
+}
+
+func __initializer_variance__ (random *Rand, W *SimpleMatrix, uniform bool, variance float64) *SimpleMatrix {
+   if uniform {
+      // Var(U(-a, a)) = a^2 / 3
+      a := math.Sqrt(3 * variance)
+      return random.FillRandom(W, -a, a)
+   }
+   return random.FillGaussian(W, 0, math.Sqrt(variance))
+}
+
+
+// Orthogonal: rows (or columns, whichever are fewer) of W are orthonormal,
+// scaled by gain; the usual choice for recurrent weights H.
+type OrthogonalInitializer struct {
+   initializerRand
+   Gain float64
+}
+
+func NewOrthogonalInitializer (gain float64) *OrthogonalInitializer {
+   return &OrthogonalInitializer{Gain: gain}
+}
+
+func (r *OrthogonalInitializer) Initialize (W *SimpleMatrix, fan_in, fan_out int) *SimpleMatrix {
+   Q := r.random().FillGaussian(NewSimpleMatrix(W.M, W.N), 0, 1)
+   transposed := W.M < W.N
+   if transposed {
+      Q = Q.T()
+   }
+   // modified Gram-Schmidt over the columns of Q (Q.M >= Q.N)
+   for j := 0; j < Q.N; j++ {
+      for k := 0; k < j; k++ {
+         dot := 0.0
+         for i := Q.M - 1; i >= 0; i-- {
+            dot += Q.Data[i][j] * Q.Data[i][k]
+         }
+         for i := Q.M - 1; i >= 0; i-- {
+            Q.Data[i][j] -= dot * Q.Data[i][k]
+         }
+      }
+      norm := 0.0
+      for i := Q.M - 1; i >= 0; i-- {
+         norm += Q.Data[i][j] * Q.Data[i][j]
+      }
+      norm = math.Sqrt(norm)
+      if LikeZero(norm) {
+         norm = 1
+      }
+      for i := Q.M - 1; i >= 0; i-- {
+         Q.Data[i][j] /= norm
+      }
+   }
+   if transposed {
+      Q = Q.T()
+   }
+   return W.FillWindow(0, 0, Q.Scale(r.Gain))
+}
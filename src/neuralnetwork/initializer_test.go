@@ -0,0 +1,77 @@
+package neuralnetwork
+
+import (
+   "math"
+   "testing"
+)
+
+func testVariance (W *SimpleMatrix) float64 {
+   n := float64(W.M * W.N)
+   mean := W.EltSum() / n
+   return W.Map(func (x float64) float64 { return (x - mean) * (x - mean) }).EltSum() / n
+}
+
+func TestInitializerVariance (t *testing.T) {
+   fan_in, fan_out := 200, 300
+   cases := []struct {
+      name string
+      initializer RandomInitializer
+      variance float64
+   }{
+      {"xavier uniform", NewXavierUniform(2), 4 * 2.0 / 500},
+      {"xavier normal", NewXavierNormal(1), 2.0 / 500},
+      {"he uniform", NewHeUniform(), 2.0 / 200},
+      {"he normal", NewHeNormal(), 2.0 / 200},
+      {"lecun normal", NewLeCunNormal(), 1.0 / 200},
+   }
+   for _, c := range cases {
+      c.initializer.SetRand(NewRand(1))
+      W := c.initializer.Initialize(NewSimpleMatrix(fan_in, fan_out), fan_in, fan_out)
+      if v := testVariance(W); math.Abs(v / c.variance - 1) > 0.05 {
+         t.Errorf("%s: variance %v, expected %v", c.name, v, c.variance)
+      }
+   }
+}
+
+func TestOrthogonalInitializer (t *testing.T) {
+   for _, dim := range [][2]int{{6, 6}, {8, 3}, {3, 8}} {
+      r := NewOrthogonalInitializer(2)
+      r.SetRand(NewRand(2))
+      W := r.Initialize(NewSimpleMatrix(dim[0], dim[1]), dim[0], dim[1])
+      // the fewer of rows and columns are orthogonal with norm gain
+      G := W.T().Dot(W)
+      if W.M < W.N {
+         G = W.Dot(W.T())
+      }
+      for i := 0; i < G.M; i++ {
+         for j := 0; j < G.N; j++ {
+            expect := 0.0
+            if i == j {
+               expect = 4
+            }
+            if math.Abs(G.Data[i][j] - expect) > 1e-9 {
+               t.Fatalf("%v: Gram matrix %v", dim, G.Data)
+            }
+         }
+      }
+   }
+}
+
+// The default of NewLayerLinear is Xavier uniform with gain 1; a given
+// initializer replaces it.
+func TestLayerLinearDefaultInitializer (t *testing.T) {
+   for _, gain := range []float64{1, 0.5} {
+      layer := NewLayerLinear(1, 100, 400, 0, false)
+      if gain != 1 {
+         layer = NewLayerLinear(1, 100, 400, 0, false, NewXavierUniform(gain))
+      }
+      layer.Reseed(NewRand(3))
+      bound := gain * math.Sqrt(6.0 / 500)
+      if layer.W.Map(math.Abs).EltMax() > bound {
+         t.Errorf("gain %v: weights beyond %v", gain, bound)
+      }
+      if v := testVariance(layer.W); math.Abs(v / (gain * gain * 2 / 500) - 1) > 0.05 {
+         t.Errorf("gain %v: variance %v", gain, v)
+      }
+   }
+}
@@ -1,5 +1,7 @@
 package neuralnetwork
 
+import "fmt"
+
 type CacheLayer interface {
    LastInput () *SimpleMatrix
    LastOutput () *SimpleMatrix
@@ -27,6 +29,50 @@ type Layer interface {
    ParamsUpdate (alpha float64)
 }
 
+type InferLayer interface {
+   // Like ForwardProp in evaluation mode, but keeps no state in the layer;
+   // safe for concurrent calls as long as parameters are not updated.
+   Infer (ctx *InferContext, input *SimpleMatrix) *SimpleMatrix
+}
+
+type ModeLayer interface {
+   // Switch between training (true) and evaluation (false) behaviour,
+   // e.g. dropout masks or batch statistics.
+   SetTraining (training bool)
+}
+
+type MaskLayer interface {
+   // Padding mask of the sequences that follow: a length * 1 matrix with 1
+   // for real positions and 0 for padding; nil for none. Infer takes the
+   // mask of its InferContext instead.
+   SetMask (mask *SimpleMatrix)
+}
+
+type ReplicaLayer interface {
+   // Deep copy of the layer: same parameters, no shared state.
+   Replica () (Layer, error)
+}
+
+type RandomLayer interface {
+   // Bind the layer to r and redraw everything random in it from r,
+   // e.g. initial weights or dropout masks.
+   Reseed (r *Rand)
+}
+
+type SequenceLayer interface {
+   // Called by recurrent wrappers whenever a new sequence starts.
+   ResetSequence ()
+}
+
+type SnapshotLayer interface {
+   // Copy of the state that BackwardProp needs from the latest ForwardProp
+   // beyond LastInput/LastOutput (dropout mask, batch statistics, caches of
+   // nested layers). Recurrent wrappers keep one per time step and restore it
+   // when back-propagating that step, instead of running the step again.
+   Snapshot () interface{}
+   Restore (snapshot interface{})
+}
+
 type LossMixin interface {
    // Calculate mean loss given output and predicted output.
    Loss (output, output_pred *SimpleMatrix) *SimpleMatrix
@@ -34,6 +80,45 @@ type LossMixin interface {
    //InputGrad (output, output_pred *SimpleMatrix) *SimpleMatrix
 }
 
+func ReplicaOf (layer Layer) (Layer, error) {
+   if l, ok := layer.(ReplicaLayer); ok {
+      return l.Replica()
+   }
+   return nil, fmt.Errorf("neuralnetwork: layer %T cannot be replicated", layer)
+}
+
+type layer_snapshot struct {
+   input, output *SimpleMatrix
+   state interface{}
+}
+
+// Caches of a layer after ForwardProp, including its Snapshot if any.
+func __snapshot__ (layer Layer) layer_snapshot {
+   s := layer_snapshot{input: layer.LastInput(), output: layer.LastOutput()}
+   if l, ok := layer.(SnapshotLayer); ok {
+      s.state = l.Snapshot()
+   }
+   return s
+}
+
+func __restore__ (layer Layer, s layer_snapshot) {
+   layer.LoadLastInput(s.input)
+   layer.LoadLastOutput(s.output)
+   if l, ok := layer.(SnapshotLayer); ok && s.state != nil {
+      l.Restore(s.state)
+   }
+}
+
+func __clone_all__ (list []*SimpleMatrix) []*SimpleMatrix {
+   r := make([]*SimpleMatrix, len(list))
+   for i, m := range list {
+      if m != nil {
+         r[i] = m.Clone()
+      }
+   }
+   return r
+}
+
 type LayerBase struct {
    Layer
    lastInput, lastOutput, lastGrad *SimpleMatrix
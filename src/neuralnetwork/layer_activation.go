@@ -4,28 +4,40 @@ package neuralnetwork
 
 type LayerActivation struct {
    LayerBase
-   Fun, FunDerivative func (float64) float64
+   Fun *Activation
+   Param *SimpleMatrix // 1 * 1, parameter of Fun
+   DeltaParam []*SimpleMatrix
+   M, N int
 }
 
-func NewLayerActivation (input_m, input_n int, fun_type string) *LayerActivation {
+func NewLayerActivation (input_m, input_n int, fun_type string) (*LayerActivation, error) {
+   // fun_type: see ActivationNames()
+   fun, err := LookupActivation(fun_type)
+   if err != nil {
+      return nil, err
+   }
    c := new(LayerActivation)
-   c.lastInput = NewSimpleMatrix(input_m, input_n)
-   switch fun_type {
-   case "tanh":
-      c.Fun = Tanh
-      c.FunDerivative = TanhDerivative
-   case "relu":
-      c.Fun = Relu
-      c.FunDerivative = ReluDerivative
-   default: /* "sigmoid" */
-      c.Fun = Sigmoid
-      c.FunDerivative = SigmoidDerivative
+   c.Fun = fun
+   c.Param = NewSimpleMatrix(1, 1).Fill(fun.Param)
+   c.DeltaParam = make([]*SimpleMatrix, 1)
+   c.DeltaParam[0] = NewSimpleMatrix(1, 1)
+   c.M = input_m
+   c.N = input_n
+   return c, nil
+}
+
+// Like NewLayerActivation but panics on an unknown fun_type; for chains built
+// from constant names.
+func MustLayerActivation (input_m, input_n int, fun_type string) *LayerActivation {
+   c, err := NewLayerActivation(input_m, input_n, fun_type)
+   if err != nil {
+      panic(err)
    }
    return c
 }
 
 func (c *LayerActivation) OutputDim () (int, int) {
-   return c.lastInput.M, c.lastInput.N
+   return c.M, c.N
 }
 
 func (c *LayerActivation) InputDim () (int, int) {
@@ -33,12 +45,79 @@ func (c *LayerActivation) InputDim () (int, int) {
 }
 
 func (c *LayerActivation) ForwardProp (input *SimpleMatrix) *SimpleMatrix {
+   a := c.Param.Data[0][0]
    c.lastInput = input.Clone()
-   c.lastOutput = input.Map(c.Fun)
+   c.lastOutput = input.Map(func (x float64) float64 {
+      return c.Fun.Fun(x, a)
+   })
    return c.lastOutput.Clone()
 }
 
+func (c *LayerActivation) Infer (ctx *InferContext, input *SimpleMatrix) *SimpleMatrix {
+   a := c.Param.Data[0][0]
+   return input.Map(func (x float64) float64 {
+      return c.Fun.Fun(x, a)
+   })
+}
+
 func (c *LayerActivation) BackwardProp (output_grad *SimpleMatrix) *SimpleMatrix {
-   c.lastGrad = output_grad.EltMul(c.lastOutput.Map(c.FunDerivative))
+   a := c.Param.Data[0][0]
+   c.lastGrad = NewSimpleMatrix(output_grad.M, output_grad.N)
+   da := 0.0
+   for i := output_grad.M - 1; i >= 0; i-- {
+      for j := output_grad.N - 1; j >= 0; j-- {
+         x := c.lastInput.Data[i][j]
+         y := c.lastOutput.Data[i][j]
+         c.lastGrad.Data[i][j] = output_grad.Data[i][j] * c.Fun.Derivative(x, y, a)
+         if c.Fun.ParamDerivative != nil {
+            da += output_grad.Data[i][j] * c.Fun.ParamDerivative(x, y, a)
+         }
+      }
+   }
+   if c.Fun.ParamDerivative != nil {
+      c.DeltaParam[0] = NewSimpleMatrix(1, 1).Fill(da)
+   }
    return c.lastGrad.Clone()
 }
+
+func (c *LayerActivation) Params () []NamedMatrix {
+   if c.Fun.ParamDerivative == nil {
+      return make([]NamedMatrix, 0)
+   }
+   return __named__([]string{"a"}, []*SimpleMatrix{c.Param})
+}
+
+func (c *LayerActivation) DeltaN () int {
+   if c.Fun.ParamDerivative == nil {
+      return 0
+   }
+   return 1
+}
+
+func (c *LayerActivation) Delta () []*SimpleMatrix {
+   if c.Fun.ParamDerivative == nil {
+      return make([]*SimpleMatrix, 0)
+   }
+   return c.DeltaParam
+}
+
+func (c *LayerActivation) CorrectDelta (delta []*SimpleMatrix, offset int) {
+   if c.Fun.ParamDerivative != nil {
+      c.DeltaParam[0] = delta[offset]
+   }
+}
+
+func (c *LayerActivation) ParamsUpdate (alpha float64) {
+   if c.Fun.ParamDerivative != nil {
+      c.Param = c.Param.Add(c.DeltaParam[0], 1, alpha)
+   }
+}
+
+func (c *LayerActivation) Replica () (Layer, error) {
+   r := new(LayerActivation)
+   *r = *c
+   r.LayerBase = LayerBase{}
+   r.Param = c.Param.Clone()
+   r.DeltaParam = __clone_all__(c.DeltaParam)
+   return r, nil
+}
@@ -0,0 +1,320 @@
+package neuralnetwork
+
+import (
+   "fmt"
+   "math"
+)
+
+// ref: https://arxiv.org/abs/1706.03762 (attention is all you need)
+//
+// A sequence is a matrix with one row per position. A padding mask is a
+// length * 1 matrix with 1 for real positions and 0 for padding; padded
+// positions are never attended to and attend to nothing, so their output rows
+// are zero and no gradient flows through them. nil means no padding.
+
+// softmax(Q.K^T / sqrt(d)).V; weights is the row-wise softmax. Q and K are
+// positions of one sequence under mask. Rows of padded queries, and rows
+// without any unmasked key, get zero weights.
+func ScaledDotProductAttention (Q, K, V, mask *SimpleMatrix) (*SimpleMatrix, *SimpleMatrix) {
+   scale := 1 / math.Sqrt(float64(Q.N))
+   weights := Q.Dot(K.T()).Scale(scale)
+   for i := weights.M - 1; i >= 0; i-- {
+      row := weights.Data[i]
+      if mask != nil && mask.Data[i][0] == 0 {
+         for j := range row {
+            row[j] = 0
+         }
+         continue
+      }
+      maxval := math.Inf(-1)
+      for j, x := range row {
+         if mask != nil && mask.Data[j][0] == 0 {
+            continue
+         }
+         if x > maxval {
+            maxval = x
+         }
+      }
+      sum := 0.0
+      for j, x := range row {
+         if mask != nil && mask.Data[j][0] == 0 {
+            row[j] = 0
+            continue
+         }
+         row[j] = math.Exp(x - maxval)
+         sum += row[j]
+      }
+      for j := range row {
+         if sum > 0 {
+            row[j] /= sum
+         }
+      }
+   }
+   return weights.Dot(V), weights
+}
+
+// Gradients of ScaledDotProductAttention w.r.t. Q, K and V, given the weights
+// of the forward pass; the zero weights of padded queries keep their
+// gradient at zero.
+func ScaledDotProductAttentionGrad (Q, K, V, weights, output_grad *SimpleMatrix) (*SimpleMatrix, *SimpleMatrix, *SimpleMatrix) {
+   scale := 1 / math.Sqrt(float64(Q.N))
+   dV := weights.T().Dot(output_grad)
+   dW := output_grad.Dot(V.T())
+   // softmax backward: dS = W * (dW - sum(dW * W))
+   dS := NewSimpleMatrix(dW.M, dW.N)
+   for i := dW.M - 1; i >= 0; i-- {
+      dot := 0.0
+      for j := dW.N - 1; j >= 0; j-- {
+         dot += dW.Data[i][j] * weights.Data[i][j]
+      }
+      for j := dW.N - 1; j >= 0; j-- {
+         dS.Data[i][j] = weights.Data[i][j] * (dW.Data[i][j] - dot) * scale
+      }
+   }
+   return dS.Dot(K), dS.T().Dot(Q), dV
+}
+
+// Parameter-free self-attention: Q = K = V = input.
+type LayerAttention struct {
+   LayerBase
+   M, N int
+   mask, weights *SimpleMatrix
+}
+
+func NewLayerAttention (input_m, input_n int) *LayerAttention {
+   c := new(LayerAttention)
+   c.M = input_m
+   c.N = input_n
+   return c
+}
+
+func (c *LayerAttention) OutputDim () (int, int) {
+   return c.M, c.N
+}
+
+func (c *LayerAttention) InputDim () (int, int) {
+   return c.M, c.N
+}
+
+func (c *LayerAttention) SetMask (mask *SimpleMatrix) {
+   c.mask = mask
+}
+
+func (c *LayerAttention) Weights () *SimpleMatrix {
+   return c.weights
+}
+
+func (c *LayerAttention) ForwardProp (input *SimpleMatrix) *SimpleMatrix {
+   c.lastInput = input.Clone()
+   c.lastOutput, c.weights = ScaledDotProductAttention(input, input, input, c.mask)
+   return c.lastOutput.Clone()
+}
+
+// The padding mask comes from ctx, see InferContext.SetMask.
+func (c *LayerAttention) Infer (ctx *InferContext, input *SimpleMatrix) *SimpleMatrix {
+   output, _ := ScaledDotProductAttention(input, input, input, ctx.mask)
+   return output
+}
+
+func (c *LayerAttention) BackwardProp (output_grad *SimpleMatrix) *SimpleMatrix {
+   X := c.lastInput
+   dQ, dK, dV := ScaledDotProductAttentionGrad(X, X, X, c.weights, output_grad)
+   c.lastGrad = dQ.Add(dK, 1, 1).Add(dV, 1, 1)
+   return c.lastGrad.Clone()
+}
+
+func (c *LayerAttention) Snapshot () interface{} {
+   return c.weights
+}
+
+func (c *LayerAttention) Restore (snapshot interface{}) {
+   c.weights = snapshot.(*SimpleMatrix)
+}
+
+func (c *LayerAttention) Replica () (Layer, error) {
+   r := NewLayerAttention(c.M, c.N)
+   r.mask = c.mask
+   return r, nil
+}
+
+
+// Multi-head self-attention: the projections Q, K, V of the input are split
+// by columns into Heads parts, every head attends on its own, and the
+// concatenated heads are projected by O.
+type LayerMultiHeadAttention struct {
+   LayerBase
+   Heads, M, N int
+   Q, K, V, O *LayerLinear
+   mask *SimpleMatrix
+   lastQ, lastK, lastV *SimpleMatrix
+   weights []*SimpleMatrix
+}
+
+func NewLayerMultiHeadAttention (input_m, input_n, heads int, gain float64) (*LayerMultiHeadAttention, error) {
+   // gain: of the Xavier initialization of the projections
+   if heads <= 0 || input_n % heads != 0 {
+      return nil, fmt.Errorf("neuralnetwork: %d columns cannot be split into %d heads", input_n, heads)
+   }
+   c := new(LayerMultiHeadAttention)
+   c.Heads = heads
+   c.M = input_m
+   c.N = input_n
+   c.Q = NewLayerLinear(input_m, input_n, input_n, 0, false, NewXavierUniform(gain))
+   c.K = NewLayerLinear(input_m, input_n, input_n, 0, false, NewXavierUniform(gain))
+   c.V = NewLayerLinear(input_m, input_n, input_n, 0, false, NewXavierUniform(gain))
+   c.O = NewLayerLinear(input_m, input_n, input_n, 0, false, NewXavierUniform(gain))
+   return c, nil
+}
+
+func (c *LayerMultiHeadAttention) projections () []*LayerLinear {
+   return []*LayerLinear{c.Q, c.K, c.V, c.O}
+}
+
+func (c *LayerMultiHeadAttention) OutputDim () (int, int) {
+   return c.M, c.N
+}
+
+func (c *LayerMultiHeadAttention) InputDim () (int, int) {
+   return c.M, c.N
+}
+
+func (c *LayerMultiHeadAttention) SetMask (mask *SimpleMatrix) {
+   c.mask = mask
+}
+
+// Attention weights of every head in the latest ForwardProp.
+func (c *LayerMultiHeadAttention) Weights () []*SimpleMatrix {
+   return c.weights
+}
+
+func (c *LayerMultiHeadAttention) attend (q, k, v, mask *SimpleMatrix) (*SimpleMatrix, []*SimpleMatrix) {
+   d := c.N / c.Heads
+   R := NewSimpleMatrix(q.M, c.N)
+   weights := make([]*SimpleMatrix, c.Heads)
+   for h := 0; h < c.Heads; h++ {
+      var head *SimpleMatrix
+      head, weights[h] = ScaledDotProductAttention(
+         q.Window(0, h * d, q.M, d), k.Window(0, h * d, k.M, d), v.Window(0, h * d, v.M, d), mask,
+      )
+      R.FillWindow(0, h * d, head)
+   }
+   return R, weights
+}
+
+func (c *LayerMultiHeadAttention) ForwardProp (input *SimpleMatrix) *SimpleMatrix {
+   c.lastInput = input.Clone()
+   c.lastQ = c.Q.ForwardProp(input)
+   c.lastK = c.K.ForwardProp(input)
+   c.lastV = c.V.ForwardProp(input)
+   var heads *SimpleMatrix
+   heads, c.weights = c.attend(c.lastQ, c.lastK, c.lastV, c.mask)
+   c.lastOutput = c.O.ForwardProp(heads)
+   return c.lastOutput.Clone()
+}
+
+// The padding mask comes from ctx, see InferContext.SetMask.
+func (c *LayerMultiHeadAttention) Infer (ctx *InferContext, input *SimpleMatrix) *SimpleMatrix {
+   heads, _ := c.attend(c.Q.Infer(ctx, input), c.K.Infer(ctx, input), c.V.Infer(ctx, input), ctx.mask)
+   return c.O.Infer(ctx, heads)
+}
+
+func (c *LayerMultiHeadAttention) BackwardProp (output_grad *SimpleMatrix) *SimpleMatrix {
+   d := c.N / c.Heads
+   m := c.lastQ.M
+   dheads := c.O.BackwardProp(output_grad)
+   dq := NewSimpleMatrix(m, c.N)
+   dk := NewSimpleMatrix(c.lastK.M, c.N)
+   dv := NewSimpleMatrix(c.lastV.M, c.N)
+   for h := 0; h < c.Heads; h++ {
+      dQ, dK, dV := ScaledDotProductAttentionGrad(
+         c.lastQ.Window(0, h * d, m, d),
+         c.lastK.Window(0, h * d, c.lastK.M, d),
+         c.lastV.Window(0, h * d, c.lastV.M, d),
+         c.weights[h],
+         dheads.Window(0, h * d, m, d),
+      )
+      dq.FillWindow(0, h * d, dQ)
+      dk.FillWindow(0, h * d, dK)
+      dv.FillWindow(0, h * d, dV)
+   }
+   c.lastGrad = c.Q.BackwardProp(dq).Add(c.K.BackwardProp(dk), 1, 1).Add(c.V.BackwardProp(dv), 1, 1)
+   return c.lastGrad.Clone()
+}
+
+type multihead_attention_snapshot struct {
+   q, k, v *SimpleMatrix
+   weights []*SimpleMatrix
+   projections []layer_snapshot
+}
+
+func (c *LayerMultiHeadAttention) Snapshot () interface{} {
+   s := multihead_attention_snapshot{q: c.lastQ, k: c.lastK, v: c.lastV, weights: c.weights}
+   for _, p := range c.projections() {
+      s.projections = append(s.projections, __snapshot__(p))
+   }
+   return s
+}
+
+func (c *LayerMultiHeadAttention) Restore (snapshot interface{}) {
+   s := snapshot.(multihead_attention_snapshot)
+   c.lastQ, c.lastK, c.lastV, c.weights = s.q, s.k, s.v, s.weights
+   for i, p := range c.projections() {
+      __restore__(p, s.projections[i])
+   }
+}
+
+func (c *LayerMultiHeadAttention) Params () []NamedMatrix {
+   r := make([]NamedMatrix, 0)
+   for i, p := range c.projections() {
+      r = append(r, __prefix_named__([]string{"Q", "K", "V", "O"}[i], p.Params()) ...)
+   }
+   return r
+}
+
+func (c *LayerMultiHeadAttention) DeltaN () int {
+   n := 0
+   for _, p := range c.projections() {
+      n += p.DeltaN()
+   }
+   return n
+}
+
+func (c *LayerMultiHeadAttention) Delta () []*SimpleMatrix {
+   r := make([]*SimpleMatrix, 0)
+   for _, p := range c.projections() {
+      r = append(r, p.Delta() ...)
+   }
+   return r
+}
+
+func (c *LayerMultiHeadAttention) CorrectDelta (delta []*SimpleMatrix, offset int) {
+   for _, p := range c.projections() {
+      p.CorrectDelta(delta, offset)
+      offset += p.DeltaN()
+   }
+}
+
+func (c *LayerMultiHeadAttention) ParamsUpdate (alpha float64) {
+   for _, p := range c.projections() {
+      p.ParamsUpdate(alpha)
+   }
+}
+
+func (c *LayerMultiHeadAttention) Reseed (r *Rand) {
+   for _, p := range c.projections() {
+      p.Reseed(r)
+   }
+}
+
+func (c *LayerMultiHeadAttention) Replica () (Layer, error) {
+   r := new(LayerMultiHeadAttention)
+   *r = *c
+   r.LayerBase = LayerBase{}
+   q, _ := c.Q.Replica()
+   k, _ := c.K.Replica()
+   v, _ := c.V.Replica()
+   o, _ := c.O.Replica()
+   r.Q, r.K, r.V, r.O = q.(*LayerLinear), k.(*LayerLinear), v.(*LayerLinear), o.(*LayerLinear)
+   r.lastQ, r.lastK, r.lastV, r.weights = nil, nil, nil, nil
+   return r, nil
+}
@@ -0,0 +1,152 @@
+package neuralnetwork
+
+import (
+   "math"
+   "sync"
+   "testing"
+)
+
+func TestLayerMultiHeadAttentionGradient (t *testing.T) {
+   attention, err := NewLayerMultiHeadAttention(5, 4, 2, 1.0)
+   if err != nil {
+      t.Fatal(err)
+   }
+   n := NewNeuralChain()
+   n.AddLayer(NewLayerSinusoidalEncoding(5, 4))
+   n.AddLayer(attention)
+   n.AddLayer(MustLayerActivation(5, 4, "tanh"))
+   n.Seed(1)
+   mask := NewSimpleMatrix(5, 1).FillElt([]float64{1, 1, 1, 0, 0})
+   random := NewRand(2)
+   input := random.FillRandom(NewSimpleMatrix(5, 4), -1, 1)
+   expect := random.FillRandom(NewSimpleMatrix(5, 4), -1, 1)
+   checkTestLinearDelta(t, n, []*LayerLinear{attention.Q, attention.K, attention.V, attention.O}, input, expect, mask)
+   if _, err := NewLayerMultiHeadAttention(5, 4, 3, 1.0); err == nil {
+      t.Fail()
+   }
+}
+
+func TestLayerAttentionPaddingMask (t *testing.T) {
+   attention, _ := NewLayerMultiHeadAttention(4, 4, 2, 1.0)
+   attention.Reseed(NewRand(3))
+   attention.SetMask(NewSimpleMatrix(4, 1).FillElt([]float64{1, 1, 0, 0}))
+   random := NewRand(4)
+   a := random.FillRandom(NewSimpleMatrix(4, 4), -1, 1)
+   b := a.Clone()
+   b.FillWindow(2, 0, random.FillRandom(NewSimpleMatrix(2, 4), -1, 1))
+   ya := attention.ForwardProp(a).Window(0, 0, 2, 4)
+   yb := attention.ForwardProp(b).Window(0, 0, 2, 4)
+   if ya.Add(yb, 1, -1).Map(math.Abs).EltMax() > 1e-12 {
+      t.Error("padded positions change real positions")
+   }
+   for _, weights := range attention.Weights() {
+      if weights.Window(0, 2, 4, 2).Map(math.Abs).EltMax() != 0 {
+         t.Error("padded positions attended")
+      }
+   }
+
+   // the gradient of the padded positions of the input comes only from
+   // their own (query) rows
+   grad := NewSimpleMatrix(4, 4).FillWindow(0, 0, NewSimpleMatrix(2, 4).Fill(1))
+   dx := attention.BackwardProp(grad)
+   if dx.Window(2, 0, 2, 4).Map(math.Abs).EltMax() != 0 {
+      t.Error("gradient leaks into padded positions")
+   }
+}
+
+// Padded query positions give zero output, and a gradient on them reaches
+// neither the input nor the parameters.
+func TestLayerAttentionPaddedQuery (t *testing.T) {
+   mask := NewSimpleMatrix(4, 1).FillElt([]float64{1, 1, 1, 0})
+   random := NewRand(5)
+   input := random.FillRandom(NewSimpleMatrix(4, 4), -1, 1)
+   grad := random.FillRandom(NewSimpleMatrix(4, 4), -1, 1)
+   real := grad.Clone().FillWindow(3, 0, NewSimpleMatrix(1, 4))
+
+   attention, _ := NewLayerMultiHeadAttention(4, 4, 2, 1.0)
+   attention.Reseed(NewRand(6))
+   attention.SetMask(mask)
+   single := NewLayerAttention(4, 4)
+   single.SetMask(mask)
+   for _, layer := range []Layer{attention, single} {
+      if layer.ForwardProp(input).Window(3, 0, 1, 4).Map(math.Abs).EltMax() != 0 {
+         t.Errorf("%T: output at a padded query", layer)
+      }
+      dx := layer.BackwardProp(grad)
+      delta := __clone_all__(layer.Delta())
+      expect := layer.BackwardProp(real)
+      if dx.Add(expect, 1, -1).Map(math.Abs).EltMax() > 1e-12 || dx.Window(3, 0, 1, 4).Map(math.Abs).EltMax() != 0 {
+         t.Errorf("%T: gradient through a padded query", layer)
+      }
+      for i, d := range layer.Delta() {
+         if d.Add(delta[i], 1, -1).Map(math.Abs).EltMax() > 1e-12 {
+            t.Errorf("%T: delta %d depends on a padded query", layer, i)
+         }
+      }
+   }
+   if attention.Infer(NewInferContext().SetMask(mask), input).Window(3, 0, 1, 4).Map(math.Abs).EltMax() != 0 {
+      t.Error("inference output at a padded query")
+   }
+}
+
+// Inference takes the padding mask of its context, so concurrent calls with
+// different padding do not see each other's masks (go test -race).
+func TestLayerAttentionInferMask (t *testing.T) {
+   attention, _ := NewLayerMultiHeadAttention(4, 4, 2, 1.0)
+   attention.Reseed(NewRand(7))
+   input := NewRand(8).FillRandom(NewSimpleMatrix(4, 4), -1, 1)
+   masks := []*SimpleMatrix{
+      nil,
+      NewSimpleMatrix(4, 1).FillElt([]float64{1, 1, 1, 0}),
+      NewSimpleMatrix(4, 1).FillElt([]float64{1, 0, 0, 0}),
+   }
+   expect := make([]*SimpleMatrix, len(masks))
+   for i, mask := range masks {
+      attention.SetMask(mask)
+      expect[i] = attention.ForwardProp(input)
+   }
+   attention.SetMask(masks[1])
+
+   var wg sync.WaitGroup
+   for g := 0; g < 6; g++ {
+      wg.Add(1)
+      go func (i int) {
+         defer wg.Done()
+         for round := 0; round < 20; round++ {
+            ctx := NewInferContext().SetMask(masks[i])
+            if attention.Infer(ctx, input).Add(expect[i], 1, -1).Map(math.Abs).EltMax() > 1e-12 {
+               t.Errorf("mask %d: output of another mask", i)
+               return
+            }
+         }
+      }(g % len(masks))
+   }
+   wg.Wait()
+}
+
+func TestLayerTransformerEncoderGradient (t *testing.T) {
+   encoder, err := NewLayerTransformerEncoder(3, 4, 2, 6, 1.0)
+   if err != nil {
+      t.Fatal(err)
+   }
+   n := NewNeuralChain()
+   n.AddLayer(NewLayerLearnedEncoding(3, 4, 0.1))
+   n.AddLayer(encoder)
+   n.Seed(5)
+   feed_forward := encoder.Layers[2].(*LayerResidual).Chain
+   random := NewRand(6)
+   input := random.FillRandom(NewSimpleMatrix(3, 4), -1, 1)
+   expect := random.FillRandom(NewSimpleMatrix(3, 4), -1, 1)
+   checkTestLinearDelta(t, n, []*LayerLinear{
+      encoder.Attention.Q, encoder.Attention.K, encoder.Attention.V, encoder.Attention.O,
+      feed_forward.Layers[0].(*LayerLinear), feed_forward.Layers[2].(*LayerLinear),
+   }, input, expect, nil)
+
+   replica, err := n.Replica()
+   if err != nil {
+      t.Fatal(err)
+   }
+   if replica.(*NeuralChain).Predict(input).Add(n.Predict(input), 1, -1).Map(math.Abs).EltMax() > 1e-12 {
+      t.Fail()
+   }
+}
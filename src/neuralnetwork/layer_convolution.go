@@ -8,16 +8,21 @@ type LayerConvolution struct {
    DeltaWb []*SimpleMatrix
    WeightDecay float64
    InputM, M, N, ItemM, ItemN, KernelM, KernelN int
+   Initializer Initializer
 }
 
 func NewLayerConvolution (
    input_m, input_n, output_n int,
    item_m, item_n, kernel_m, kernel_n int,
    weight_decay float64,
+   initializer ...Initializer,
 ) *LayerConvolution {
+   // initializer default: Xavier uniform
    c := new(LayerConvolution)
-   c.W = NewSimpleMatrix(
-      input_n * kernel_m, output_n * kernel_n).FillRandom(-1, 1)
+   c.Initializer = __initializer_pick__(initializer, NewXavierUniform(1))
+   c.W = c.Initializer.Initialize(
+      NewSimpleMatrix(input_n * kernel_m, output_n * kernel_n),
+      input_n * kernel_m * kernel_n, output_n * kernel_m * kernel_n)
    c.B = NewSimpleMatrix(input_n, output_n)
    c.DeltaWb = make([]*SimpleMatrix, 2)
    c.DeltaWb[0] = NewSimpleMatrix(c.W.M, c.W.N) // dW
@@ -33,6 +38,12 @@ func NewLayerConvolution (
    return c
 }
 
+func (c *LayerConvolution) Reseed (r *Rand) {
+   c.W = __initializer_redraw__(
+      c.Initializer, r, NewSimpleMatrix(c.W.M, c.W.N),
+      c.M * c.KernelM * c.KernelN, c.N * c.KernelM * c.KernelN)
+}
+
 func (c *LayerConvolution) OutputDim () (int, int) {
    return c.InputM * c.ItemM, c.N * c.ItemN
 }
@@ -108,6 +119,14 @@ func (c *LayerConvolution) ForwardProp (input *SimpleMatrix) *SimpleMatrix {
 }
 
 
+func (c *LayerConvolution) Infer (ctx *InferContext, input *SimpleMatrix) *SimpleMatrix {
+   return __lconv_matrix_conv__(
+      input, c.InputM, c.M, c.ItemM, c.ItemN,
+      c.W, c.N, c.KernelM, c.KernelN, c.B,
+   )
+}
+
+
 func __unused_lconv_b_conv__ (X, Kernel *SimpleMatrix) *SimpleMatrix {
    R := NewSimpleMatrix(X.M + Kernel.M - 1, X.N + Kernel.N - 1)
    km := Kernel.M - 1
@@ -182,6 +201,10 @@ func (c *LayerConvolution) BackwardProp (output_grad *SimpleMatrix) *SimpleMatri
    return c.lastGrad.Clone()
 }
 
+func (c *LayerConvolution) Params () []NamedMatrix {
+   return __named__([]string{"W", "b"}, []*SimpleMatrix{c.W, c.B})
+}
+
 func (c *LayerConvolution) DeltaN () int {
    return 2
 }
@@ -199,3 +222,13 @@ func (c *LayerConvolution) ParamsUpdate (alpha float64) {
    c.W = c.W.Add(c.DeltaWb[0], 1 - c.WeightDecay, alpha)
    c.B = c.B.Add(c.DeltaWb[1], 1, alpha)
 }
+
+func (c *LayerConvolution) Replica () (Layer, error) {
+   r := new(LayerConvolution)
+   *r = *c
+   r.LayerBase = LayerBase{}
+   r.W = c.W.Clone()
+   r.B = c.B.Clone()
+   r.DeltaWb = __clone_all__(c.DeltaWb)
+   return r, nil
+}
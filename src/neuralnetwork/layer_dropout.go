@@ -0,0 +1,141 @@
+package neuralnetwork
+
+// Inverted dropout: in training mode every element is zeroed with probability
+// Rate and the others are scaled by 1/(1-Rate), so that evaluation mode is a
+// plain identity.
+type LayerDropout struct {
+   LayerBase
+   Rate float64
+   M, N int
+   mask *SimpleMatrix
+   eval bool
+   Rand *Rand
+}
+
+func NewLayerDropout (input_m, input_n int, rate float64, seed int64) *LayerDropout {
+   c := new(LayerDropout)
+   c.Rate = rate
+   c.M = input_m
+   c.N = input_n
+   c.Rand = NewRand(seed)
+   return c
+}
+
+func (c *LayerDropout) OutputDim () (int, int) {
+   return c.M, c.N
+}
+
+func (c *LayerDropout) InputDim () (int, int) {
+   return c.M, c.N
+}
+
+func (c *LayerDropout) Reseed (r *Rand) {
+   c.Rand = r
+}
+
+func (c *LayerDropout) SetTraining (training bool) {
+   c.eval = !training
+}
+
+func (c *LayerDropout) Mask () *SimpleMatrix {
+   return c.mask
+}
+
+func (c *LayerDropout) sampleMask (m, n int) *SimpleMatrix {
+   mask := NewSimpleMatrix(m, n)
+   keep := 1 - c.Rate
+   if keep <= 0 {
+      return mask
+   }
+   for i := m - 1; i >= 0; i-- {
+      for j := n - 1; j >= 0; j-- {
+         if c.Rand.Float64() < keep {
+            mask.Data[i][j] = 1 / keep
+         }
+      }
+   }
+   return mask
+}
+
+func (c *LayerDropout) ForwardProp (input *SimpleMatrix) *SimpleMatrix {
+   c.lastInput = input.Clone()
+   if c.eval {
+      c.lastOutput = input.Clone()
+   } else {
+      c.mask = c.sampleMask(input.M, input.N)
+      c.lastOutput = input.EltMul(c.mask)
+   }
+   return c.lastOutput.Clone()
+}
+
+// Inference is evaluation: dropout is an identity.
+func (c *LayerDropout) Infer (ctx *InferContext, input *SimpleMatrix) *SimpleMatrix {
+   return input.Clone()
+}
+
+func (c *LayerDropout) BackwardProp (output_grad *SimpleMatrix) *SimpleMatrix {
+   if c.eval || c.mask == nil {
+      c.lastGrad = output_grad.Clone()
+   } else {
+      c.lastGrad = output_grad.EltMul(c.mask)
+   }
+   return c.lastGrad.Clone()
+}
+
+// The mask of every step, so that a recurrent wrapper back-propagates a step
+// with the mask it was run with.
+func (c *LayerDropout) Snapshot () interface{} {
+   return c.mask
+}
+
+func (c *LayerDropout) Restore (snapshot interface{}) {
+   c.mask = snapshot.(*SimpleMatrix)
+}
+
+// The replica draws from its own Rand, seeded from this layer's Rand.
+func (c *LayerDropout) Replica () (Layer, error) {
+   r := new(LayerDropout)
+   *r = *c
+   r.LayerBase = LayerBase{}
+   r.mask = nil
+   r.Rand = NewRand(c.Rand.Int63())
+   return r, nil
+}
+
+
+// Variational dropout for recurrent chains: one mask is sampled per sequence
+// and reused at every time step, so BackwardProp needs no per-step record.
+type LayerVariationalDropout struct {
+   LayerDropout
+}
+
+func NewLayerVariationalDropout (input_m, input_n int, rate float64, seed int64) *LayerVariationalDropout {
+   c := new(LayerVariationalDropout)
+   c.LayerDropout = *NewLayerDropout(input_m, input_n, rate, seed)
+   return c
+}
+
+func (c *LayerVariationalDropout) ResetSequence () {
+   c.mask = nil
+}
+
+func (c *LayerVariationalDropout) ForwardProp (input *SimpleMatrix) *SimpleMatrix {
+   c.lastInput = input.Clone()
+   if c.eval {
+      c.lastOutput = input.Clone()
+   } else {
+      if c.mask == nil {
+         c.mask = c.sampleMask(input.M, input.N)
+      }
+      c.lastOutput = input.EltMul(c.mask)
+   }
+   return c.lastOutput.Clone()
+}
+
+func (c *LayerVariationalDropout) Replica () (Layer, error) {
+   r, err := c.LayerDropout.Replica()
+   if err != nil {
+      return nil, err
+   }
+   return &LayerVariationalDropout{LayerDropout: *r.(*LayerDropout)}, nil
+}
@@ -0,0 +1,122 @@
+package neuralnetwork
+
+import (
+   "math"
+   "testing"
+)
+
+func TestLayerDropoutMask (t *testing.T) {
+   dropout := NewLayerDropout(50, 40, 0.3, 1)
+   input := NewSimpleMatrix(50, 40).Fill(2)
+   output := dropout.ForwardProp(input)
+   mask := dropout.Mask()
+   kept := 0
+   for i := range mask.Data {
+      for j, v := range mask.Data[i] {
+         // inverted scaling: kept elements are scaled by 1/(1-Rate)
+         if v != 0 && math.Abs(v - 1 / 0.7) > 1e-12 {
+            t.Fatalf("mask value %v", v)
+         }
+         if v != 0 {
+            kept ++
+         }
+         if output.Data[i][j] != 2 * v {
+            t.Fatalf("output %v for mask %v", output.Data[i][j], v)
+         }
+      }
+   }
+   if rate := 1 - float64(kept) / 2000; math.Abs(rate - 0.3) > 0.03 {
+      t.Errorf("dropped %v", rate)
+   }
+   if mean := output.EltSum() / 2000; math.Abs(mean - 2) > 0.1 {
+      t.Errorf("mean %v, expected 2", mean)
+   }
+   grad := NewSimpleMatrix(50, 40).Fill(1)
+   if dropout.BackwardProp(grad).Add(mask, 1, -1).Map(math.Abs).EltMax() != 0 {
+      t.Error("gradient does not follow the mask")
+   }
+
+   dropout.SetTraining(false)
+   if dropout.ForwardProp(input).Add(input, 1, -1).Map(math.Abs).EltMax() != 0 ||
+      dropout.BackwardProp(grad).Add(grad, 1, -1).Map(math.Abs).EltMax() != 0 {
+      t.Error("evaluation mode is not an identity")
+   }
+   if dropout.Infer(NewInferContext(), input).Add(input, 1, -1).Map(math.Abs).EltMax() != 0 {
+      t.Error("inference is not an identity")
+   }
+}
+
+func TestLayerDropoutModeThroughShadow (t *testing.T) {
+   dropout := NewLayerDropout(1, 20, 0.5, 2)
+   n := NewNeuralChain()
+   n.AddLayer(NewLayerShadow(dropout))
+   n.AddLayer(NewLayerRecordShadow(dropout, 1, 20, new(RecordInputOfLayerRecordShadow)))
+   input := NewSimpleMatrix(1, 20).Fill(1)
+   n.SetTraining(false)
+   if dropout.eval != true || n.Predict(input).Add(input, 1, -1).Map(math.Abs).EltMax() != 0 {
+      t.Error("evaluation mode does not reach the shadowed dropout")
+   }
+   n.SetTraining(true)
+   if dropout.eval != false || n.Predict(input).Add(input, 1, -1).Map(math.Abs).EltMax() == 0 {
+      t.Error("training mode does not reach the shadowed dropout")
+   }
+}
+
+// Every step of a recurrent chain back-propagates with its own mask.
+func TestRecurrentChainDropoutMaskPerStep (t *testing.T) {
+   dropout := NewLayerDropout(1, 6, 0.5, 3)
+   n := NewNeuralRecurrentChain(1, 6)
+   n.AddLayer(dropout)
+   random := NewRand(4)
+   masks := make([]*SimpleMatrix, 4)
+   predicts := make([]*SimpleMatrix, 4)
+   for i := range predicts {
+      predicts[i] = n.Predict(random.FillRandom(NewSimpleMatrix(1, 6), -1, 1))
+      masks[i] = dropout.Mask()
+   }
+   for i := len(predicts) - 1; i >= 0; i-- {
+      expect := random.FillRandom(NewSimpleMatrix(1, 6), -1, 1)
+      n.Learn(predicts[i], expect)
+      grad := expect.Add(predicts[i], 1, -1).EltMul(masks[i])
+      if dropout.LastGrad().Add(grad, 1, -1).Map(math.Abs).EltMax() != 0 {
+         t.Fatalf("step %d: back-propagated with another mask", i)
+      }
+   }
+}
+
+// Variational dropout keeps one mask for a whole sequence and draws a new
+// one for the next.
+func TestRecurrentChainVariationalDropout (t *testing.T) {
+   dropout := NewLayerVariationalDropout(1, 8, 0.5, 5)
+   n := NewNeuralRecurrentChain(1, 8)
+   n.AddLayer(dropout)
+   random := NewRand(6)
+   var first *SimpleMatrix
+   for round := 0; round < 2; round++ {
+      predicts := make([]*SimpleMatrix, 3)
+      var mask *SimpleMatrix
+      for i := range predicts {
+         input := random.FillRandom(NewSimpleMatrix(1, 8), -1, 1)
+         predicts[i] = n.Predict(input)
+         if mask == nil {
+            mask = dropout.Mask()
+         }
+         if predicts[i].Add(input.EltMul(mask), 1, -1).Map(math.Abs).EltMax() != 0 {
+            t.Fatalf("round %d step %d: mask changed within the sequence", round, i)
+         }
+      }
+      for i := len(predicts) - 1; i >= 0; i-- {
+         expect := random.FillRandom(NewSimpleMatrix(1, 8), -1, 1)
+         n.Learn(predicts[i], expect)
+         if dropout.LastGrad().Add(expect.Add(predicts[i], 1, -1).EltMul(mask), 1, -1).Map(math.Abs).EltMax() != 0 {
+            t.Fatalf("round %d step %d: gradient does not follow the mask", round, i)
+         }
+      }
+      n.Update(0.1)
+      if round == 0 {
+         first = mask
+      } else if first.Add(mask, 1, -1).Map(math.Abs).EltMax() == 0 {
+         t.Error("same mask for a new sequence")
+      }
+   }
+}
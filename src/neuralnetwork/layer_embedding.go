@@ -0,0 +1,133 @@
+package neuralnetwork
+
+// Embedding lookup: input is an input_m * 1 matrix of token indices, output
+// is the input_m * dim matrix of the corresponding rows of W. Tokens out of
+// [0, vocab) are embedded as zero rows.
+//
+// Gradients are accumulated sparsely into the used rows of DeltaW across
+// BackwardProp calls and applied (then cleared) by ParamsUpdate.
+type LayerEmbedding struct {
+   LayerBase
+   W *SimpleMatrix
+   DeltaW []*SimpleMatrix
+   InputM int
+   Initializer Initializer
+   used map[int]bool
+}
+
+func NewLayerEmbedding (input_m, vocab, dim int, weight_scale float64, initializer ...Initializer) *LayerEmbedding {
+   // initializer default: normal distribution with weight_scale as std
+   c := new(LayerEmbedding)
+   c.Initializer = __initializer_pick__(initializer, NewNormalInitializer(0, weight_scale))
+   c.W = c.Initializer.Initialize(NewSimpleMatrix(vocab, dim), vocab, dim)
+   c.DeltaW = make([]*SimpleMatrix, 1)
+   c.DeltaW[0] = NewSimpleMatrix(vocab, dim)
+   c.InputM = input_m
+   c.used = make(map[int]bool)
+   return c
+}
+
+func (c *LayerEmbedding) Reseed (r *Rand) {
+   c.W = __initializer_redraw__(c.Initializer, r, NewSimpleMatrix(c.W.M, c.W.N), c.W.M, c.W.N)
+}
+
+func (c *LayerEmbedding) OutputDim () (int, int) {
+   return c.InputM, c.W.N
+}
+
+func (c *LayerEmbedding) InputDim () (int, int) {
+   return c.InputM, 1
+}
+
+func (c *LayerEmbedding) token (x float64) (int, bool) {
+   i := int(x)
+   return i, i >= 0 && i < c.W.M
+}
+
+func (c *LayerEmbedding) ForwardProp (input *SimpleMatrix) *SimpleMatrix {
+   c.lastInput = input.Clone()
+   c.lastOutput = NewSimpleMatrix(input.M, c.W.N)
+   for i := input.M - 1; i >= 0; i-- {
+      if k, ok := c.token(input.Data[i][0]); ok {
+         copy(c.lastOutput.Data[i], c.W.Data[k])
+      }
+   }
+   return c.lastOutput.Clone()
+}
+
+func (c *LayerEmbedding) Infer (ctx *InferContext, input *SimpleMatrix) *SimpleMatrix {
+   R := NewSimpleMatrix(input.M, c.W.N)
+   for i := input.M - 1; i >= 0; i-- {
+      if k, ok := c.token(input.Data[i][0]); ok {
+         copy(R.Data[i], c.W.Data[k])
+      }
+   }
+   return R
+}
+
+func (c *LayerEmbedding) BackwardProp (output_grad *SimpleMatrix) *SimpleMatrix {
+   dW := c.DeltaW[0]
+   for i := c.lastInput.M - 1; i >= 0; i-- {
+      k, ok := c.token(c.lastInput.Data[i][0])
+      if !ok {
+         continue
+      }
+      for j := dW.N - 1; j >= 0; j-- {
+         dW.Data[k][j] += output_grad.Data[i][j]
+      }
+      c.used[k] = true
+   }
+   // token indices are not differentiable
+   c.lastGrad = NewSimpleMatrix(c.lastInput.M, c.lastInput.N)
+   return c.lastGrad.Clone()
+}
+
+func (c *LayerEmbedding) Params () []NamedMatrix {
+   return __named__([]string{"W"}, []*SimpleMatrix{c.W})
+}
+
+func (c *LayerEmbedding) DeltaN () int {
+   return 1
+}
+
+func (c *LayerEmbedding) Delta () []*SimpleMatrix {
+   return c.DeltaW
+}
+
+// delta is copied: BackwardProp and ParamsUpdate change DeltaW in place, and
+// the caller keeps its matrix.
+func (c *LayerEmbedding) CorrectDelta (delta []*SimpleMatrix, offset int) {
+   c.DeltaW[0] = delta[offset].Clone()
+   for k, row := range c.DeltaW[0].Data {
+      for _, v := range row {
+         if v != 0 {
+            c.used[k] = true
+            break
+         }
+      }
+   }
+}
+
+func (c *LayerEmbedding) ParamsUpdate (alpha float64) {
+   dW := c.DeltaW[0]
+   for k := range c.used {
+      for j := dW.N - 1; j >= 0; j-- {
+         c.W.Data[k][j] += alpha * dW.Data[k][j]
+         dW.Data[k][j] = 0
+      }
+   }
+   c.used = make(map[int]bool)
+}
+
+func (c *LayerEmbedding) Replica () (Layer, error) {
+   r := new(LayerEmbedding)
+   *r = *c
+   r.LayerBase = LayerBase{}
+   r.W = c.W.Clone()
+   r.DeltaW = __clone_all__(c.DeltaW)
+   r.used = make(map[int]bool)
+   for k := range c.used {
+      r.used[k] = true
+   }
+   return r, nil
+}
@@ -0,0 +1,66 @@
+package neuralnetwork
+
+import (
+   "math"
+   "testing"
+)
+
+// Through a recurrent chain, the rows of the looked-up tokens sum the
+// gradients of every step they appear in; other rows get none.
+func TestRecurrentChainEmbeddingSparseDelta (t *testing.T) {
+   embedding := NewLayerEmbedding(1, 6, 3, 0.5)
+   linear := NewLayerLinear(1, 3, 2, 0, false)
+   n := NewNeuralRecurrentChain(1, 1)
+   n.AddLayer(embedding)
+   n.AddLayer(linear)
+   n.Seed(7)
+
+   tokens := []float64{1, 4, 1}
+   random := NewRand(8)
+   predicts := make([]*SimpleMatrix, len(tokens))
+   for i, token := range tokens {
+      predicts[i] = n.Predict(NewSimpleMatrix(1, 1).Fill(token))
+   }
+   expect := NewSimpleMatrix(6, 3)
+   for i := len(tokens) - 1; i >= 0; i-- {
+      y := random.FillRandom(NewSimpleMatrix(1, 2), -1, 1)
+      n.Learn(predicts[i], y)
+      grad := y.Add(predicts[i], 1, -1).Dot(linear.W.T())
+      k := int(tokens[i])
+      expect.FillWindow(k, 0, expect.Window(k, 0, 1, 3).Add(grad, 1, 1))
+   }
+   if embedding.Delta()[0].Add(expect, 1, -1).Map(math.Abs).EltMax() > 1e-12 {
+      t.Fatalf("delta %v, expected %v", embedding.Delta()[0].Data, expect.Data)
+   }
+
+   W := embedding.W.Clone()
+   n.Update(0.1)
+   for k := 0; k < 6; k++ {
+      changed := embedding.W.Window(k, 0, 1, 3).Add(W.Window(k, 0, 1, 3), 1, -1).Map(math.Abs).EltMax() > 0
+      if changed != (k == 1 || k == 4) {
+         t.Errorf("row %d changed: %v", k, changed)
+      }
+   }
+   if embedding.Delta()[0].Map(math.Abs).EltMax() != 0 {
+      t.Error("delta not cleared by the update")
+   }
+}
+
+// CorrectDelta copies the delta it is given, which the layer goes on to
+// accumulate into and clear.
+func TestLayerEmbeddingCorrectDeltaCopies (t *testing.T) {
+   embedding := NewLayerEmbedding(1, 4, 2, 0.5)
+   delta := NewSimpleMatrix(4, 2).FillWindow(2, 0, NewSimpleMatrix(1, 2).Fill(1))
+   before := delta.Clone()
+   embedding.CorrectDelta([]*SimpleMatrix{delta}, 0)
+   embedding.ForwardProp(NewSimpleMatrix(1, 1).Fill(2))
+   embedding.BackwardProp(NewSimpleMatrix(1, 2).Fill(3))
+   W := embedding.W.Clone()
+   embedding.ParamsUpdate(0.1)
+   if delta.Add(before, 1, -1).Map(math.Abs).EltMax() != 0 {
+      t.Error("the delta of the caller changed")
+   }
+   if embedding.W.Add(W, 1, -1).Window(2, 0, 1, 2).Add(NewSimpleMatrix(1, 2).Fill(0.4), 1, -1).Map(math.Abs).EltMax() > 1e-12 {
+      t.Error("update does not apply the corrected and accumulated delta")
+   }
+}
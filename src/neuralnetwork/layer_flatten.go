@@ -26,6 +26,10 @@ func (c *LayerFlatten) ForwardProp (input *SimpleMatrix) *SimpleMatrix {
    return input.Reshape(1, c.InputM * c.InputN)
 }
 
+func (c *LayerFlatten) Infer (ctx *InferContext, input *SimpleMatrix) *SimpleMatrix {
+   return input.Reshape(1, c.InputM * c.InputN)
+}
+
 func (c *LayerFlatten) BackwardProp (output_grad *SimpleMatrix) *SimpleMatrix {
    return output_grad.Reshape(c.InputM, c.InputN)
 }
@@ -43,3 +47,7 @@ func (c *LayerFlatten) CorrectDelta (delta []*SimpleMatrix, offset int) {
 
 func (c *LayerFlatten) ParamsUpdate (alpha float64) {
 }
+
+func (c *LayerFlatten) Replica () (Layer, error) {
+   return NewLayerFlatten(c.InputM, c.InputN), nil
+}
@@ -6,23 +6,37 @@ type LayerLinear struct {
    LayerBase
    W, B *SimpleMatrix
    DeltaWb []*SimpleMatrix // W, b
-   WeightScale, WeightDecay float64
+   WeightDecay float64
    EnableB bool
+   Initializer Initializer
 }
 
-func NewLayerLinear (input_m, input_n, output_n int, weight_scale, weight_decay float64, enable_b bool) *LayerLinear {
+func NewLayerLinear (
+   input_m, input_n, output_n int,
+   weight_decay float64, enable_b bool,
+   initializer ...Initializer,
+) *LayerLinear {
    // weight_decay default: 0.0
+   // initializer default: Xavier uniform with gain 1, e.g. NewXavierUniform(gain)
+   // for another gain
+   // enable_b: add and train the bias B; without it B stays zero and the b
+   // entry of Delta() is neither filled nor applied
    c := new(LayerLinear)
-   c.W = NewSimpleMatrix(input_n, output_n).FillGuassian(0, weight_scale)
+   c.Initializer = __initializer_pick__(initializer, NewXavierUniform(1))
+   c.W = c.Initializer.Initialize(NewSimpleMatrix(input_n, output_n), input_n, output_n)
    c.B = NewSimpleMatrix(input_m, output_n)
    c.DeltaWb = make([]*SimpleMatrix, 2)
    c.DeltaWb[0] = NewSimpleMatrix(input_n, output_n) // dW
    c.DeltaWb[1] = NewSimpleMatrix(input_m, output_n) // db
-   c.WeightScale = weight_scale
    c.WeightDecay = weight_decay
+   c.EnableB = enable_b
    return c
 }
 
+func (c *LayerLinear) Reseed (r *Rand) {
+   c.W = __initializer_redraw__(c.Initializer, r, NewSimpleMatrix(c.W.M, c.W.N), c.W.M, c.W.N)
+}
+
 func (c *LayerLinear) OutputDim () (int, int) {
    return c.B.M, c.B.N
 }
@@ -40,15 +54,27 @@ func (c *LayerLinear) ForwardProp (input *SimpleMatrix) *SimpleMatrix {
    return c.lastOutput.Clone()
 }
 
+func (c *LayerLinear) Infer (ctx *InferContext, input *SimpleMatrix) *SimpleMatrix {
+   output := input.Dot(c.W)
+   if c.EnableB {
+      output = output.Add(c.B, 1, 1)
+   }
+   return output
+}
+
 func (c *LayerLinear) BackwardProp (output_grad *SimpleMatrix) *SimpleMatrix {
    c.DeltaWb[0] = c.lastInput.T().Dot(output_grad).Add(c.W.Scale(c.WeightDecay), 1, 1)
    if c.EnableB {
-      c.DeltaWb[1] = output_grad.Add(c.lastInput.Dot(c.DeltaWb[0]), 1, 1)
+      c.DeltaWb[1] = output_grad.Clone()
    }
    c.lastGrad = output_grad.Dot(c.W.T())
    return c.lastGrad.Clone()
 }
 
+func (c *LayerLinear) Params () []NamedMatrix {
+   return __named__([]string{"W", "b"}, []*SimpleMatrix{c.W, c.B})
+}
+
 func (c *LayerLinear) DeltaN () int {
    return 2
 }
@@ -70,3 +96,13 @@ func (c *LayerLinear) ParamsUpdate (alpha float64) {
       c.B = c.B.Add(c.DeltaWb[1].Scale(alpha), 1, 1)
    }
 }
+
+func (c *LayerLinear) Replica () (Layer, error) {
+   r := new(LayerLinear)
+   *r = *c
+   r.LayerBase = LayerBase{}
+   r.W = c.W.Clone()
+   r.B = c.B.Clone()
+   r.DeltaWb = __clone_all__(c.DeltaWb)
+   return r, nil
+}
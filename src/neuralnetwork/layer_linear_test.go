@@ -0,0 +1,41 @@
+package neuralnetwork
+
+import (
+   "math"
+   "testing"
+)
+
+// enable_b decides whether B is added and trained; Delta() carries a b entry
+// either way.
+func TestLayerLinearEnableB (t *testing.T) {
+   random := NewRand(11)
+   input := random.FillRandom(NewSimpleMatrix(2, 3), -1, 1)
+   expect := random.FillRandom(NewSimpleMatrix(2, 2), -1, 1)
+
+   with := NewLayerLinear(2, 3, 2, 0, true)
+   with.Reseed(NewRand(12))
+   random.FillRandom(with.B, -0.5, 0.5)
+   loss := func () float64 {
+      d := expect.Add(with.ForwardProp(input), 1, -1)
+      return 0.5 * d.EltMul(d).EltSum()
+   }
+   with.BackwardProp(expect.Add(with.ForwardProp(input), 1, -1))
+   checkTestDelta(t, "b", with.B, with.Delta()[1], loss)
+   before := with.B.Clone()
+   with.ParamsUpdate(0.1)
+   if with.B.Add(before, 1, -1).Map(math.Abs).EltMax() == 0 {
+      t.Error("bias not trained")
+   }
+
+   without := NewLayerLinear(2, 3, 2, 0, false)
+   without.Reseed(NewRand(12))
+   if without.ForwardProp(input).Add(input.Dot(without.W), 1, -1).Map(math.Abs).EltMax() != 0 {
+      t.Error("bias added")
+   }
+   without.BackwardProp(expect)
+   without.CorrectDelta([]*SimpleMatrix{without.Delta()[0], NewSimpleMatrix(2, 2).Fill(1)}, 0)
+   without.ParamsUpdate(0.1)
+   if without.DeltaN() != 2 || len(without.Delta()) != 2 || without.B.Map(math.Abs).EltMax() != 0 {
+      t.Error("bias trained")
+   }
+}
@@ -34,6 +34,10 @@ func (c *LayerLogRegression) ForwardProp (input *SimpleMatrix) *SimpleMatrix {
    return c.lastOutput.Clone()
 }
 
+func (c *LayerLogRegression) Infer (ctx *InferContext, input *SimpleMatrix) *SimpleMatrix {
+   return input.Softmax()
+}
+
 func (c *LayerLogRegression) BackwardProp (output_grad *SimpleMatrix) *SimpleMatrix {
    // LogRegression does not support back-propagation of gradients.
    // It should occur only as the last layer of a NeuralChain.
@@ -59,3 +63,7 @@ func (c *LayerLogRegression) Loss (output, output_pred *SimpleMatrix) *SimpleMat
    }
    return loss
 }
+
+func (c *LayerLogRegression) Replica () (Layer, error) {
+   return NewLayerLogRegression(c.M, c.N), nil
+}
@@ -0,0 +1,333 @@
+package neuralnetwork
+
+import "math"
+
+// ref: https://arxiv.org/abs/1502.03167 (batch normalization)
+//      https://arxiv.org/abs/1607.06450 (layer normalization)
+
+// Normalize every column over the rows (samples) of the input, then scale
+// and shift with learnable Gamma and Beta. Evaluation mode uses the running
+// mean and variance gathered in training mode instead of batch statistics.
+type LayerBatchNorm struct {
+   LayerBase
+   Gamma, Beta *SimpleMatrix
+   RunningMean, RunningVar *SimpleMatrix
+   DeltaGb []*SimpleMatrix // Gamma, Beta
+   Momentum, Epsilon float64
+   M, N int
+   lastNorm, lastInvStd *SimpleMatrix
+   eval bool
+}
+
+func NewLayerBatchNorm (input_m, input_n int, momentum float64) *LayerBatchNorm {
+   // momentum default: 0.9
+   c := new(LayerBatchNorm)
+   c.Gamma = NewSimpleMatrix(1, input_n).Fill(1)
+   c.Beta = NewSimpleMatrix(1, input_n)
+   c.RunningMean = NewSimpleMatrix(1, input_n)
+   c.RunningVar = NewSimpleMatrix(1, input_n).Fill(1)
+   c.DeltaGb = make([]*SimpleMatrix, 2)
+   c.DeltaGb[0] = NewSimpleMatrix(1, input_n) // dGamma
+   c.DeltaGb[1] = NewSimpleMatrix(1, input_n) // dBeta
+   c.Momentum = momentum
+   c.Epsilon = 1e-5
+   c.M = input_m
+   c.N = input_n
+   return c
+}
+
+func (c *LayerBatchNorm) OutputDim () (int, int) {
+   return c.M, c.N
+}
+
+func (c *LayerBatchNorm) InputDim () (int, int) {
+   return c.M, c.N
+}
+
+func (c *LayerBatchNorm) SetTraining (training bool) {
+   c.eval = !training
+}
+
+func (c *LayerBatchNorm) ForwardProp (input *SimpleMatrix) *SimpleMatrix {
+   m := input.M
+   c.lastInput = input.Clone()
+   c.lastNorm = NewSimpleMatrix(m, input.N)
+   c.lastInvStd = NewSimpleMatrix(1, input.N)
+   for j := input.N - 1; j >= 0; j-- {
+      var mean, variance float64
+      if c.eval {
+         mean = c.RunningMean.Data[0][j]
+         variance = c.RunningVar.Data[0][j]
+      } else {
+         mean, variance = __norm_mean_var__(input.Col(j).T().Data[0])
+         c.RunningMean.Data[0][j] = c.Momentum * c.RunningMean.Data[0][j] + (1 - c.Momentum) * mean
+         c.RunningVar.Data[0][j] = c.Momentum * c.RunningVar.Data[0][j] + (1 - c.Momentum) * variance
+      }
+      inv_std := 1 / math.Sqrt(variance + c.Epsilon)
+      c.lastInvStd.Data[0][j] = inv_std
+      for i := m - 1; i >= 0; i-- {
+         c.lastNorm.Data[i][j] = (input.Data[i][j] - mean) * inv_std
+      }
+   }
+   c.lastOutput = __norm_affine__(c.lastNorm, c.Gamma, c.Beta)
+   return c.lastOutput.Clone()
+}
+
+// Inference is evaluation: running statistics are used and left unchanged.
+func (c *LayerBatchNorm) Infer (ctx *InferContext, input *SimpleMatrix) *SimpleMatrix {
+   R := NewSimpleMatrix(input.M, input.N)
+   for j := input.N - 1; j >= 0; j-- {
+      inv_std := 1 / math.Sqrt(c.RunningVar.Data[0][j] + c.Epsilon)
+      for i := input.M - 1; i >= 0; i-- {
+         R.Data[i][j] = (input.Data[i][j] - c.RunningMean.Data[0][j]) * inv_std
+      }
+   }
+   return __norm_affine__(R, c.Gamma, c.Beta)
+}
+
+func (c *LayerBatchNorm) BackwardProp (output_grad *SimpleMatrix) *SimpleMatrix {
+   m := output_grad.M
+   c.lastGrad = NewSimpleMatrix(m, output_grad.N)
+   c.DeltaGb[0] = NewSimpleMatrix(1, output_grad.N)
+   c.DeltaGb[1] = NewSimpleMatrix(1, output_grad.N)
+   for j := output_grad.N - 1; j >= 0; j-- {
+      gamma := c.Gamma.Data[0][j]
+      inv_std := c.lastInvStd.Data[0][j]
+      dgamma := 0.0
+      dbeta := 0.0
+      dnorm := make([]float64, m)
+      norm := make([]float64, m)
+      for i := m - 1; i >= 0; i-- {
+         dgamma += output_grad.Data[i][j] * c.lastNorm.Data[i][j]
+         dbeta += output_grad.Data[i][j]
+         dnorm[i] = output_grad.Data[i][j] * gamma
+         norm[i] = c.lastNorm.Data[i][j]
+      }
+      c.DeltaGb[0].Data[0][j] = dgamma
+      c.DeltaGb[1].Data[0][j] = dbeta
+      var dx []float64
+      if c.eval {
+         // running statistics are constants
+         dx = make([]float64, m)
+         for i := m - 1; i >= 0; i-- {
+            dx[i] = dnorm[i] * inv_std
+         }
+      } else {
+         dx = __norm_backward__(dnorm, norm, inv_std)
+      }
+      for i := m - 1; i >= 0; i-- {
+         c.lastGrad.Data[i][j] = dx[i]
+      }
+   }
+   return c.lastGrad.Clone()
+}
+
+func (c *LayerBatchNorm) Snapshot () interface{} {
+   return []*SimpleMatrix{c.lastNorm, c.lastInvStd}
+}
+
+func (c *LayerBatchNorm) Restore (snapshot interface{}) {
+   s := snapshot.([]*SimpleMatrix)
+   c.lastNorm, c.lastInvStd = s[0], s[1]
+}
+
+func (c *LayerBatchNorm) Params () []NamedMatrix {
+   return __named__([]string{"gamma", "beta"}, []*SimpleMatrix{c.Gamma, c.Beta})
+}
+
+func (c *LayerBatchNorm) DeltaN () int {
+   return 2
+}
+
+func (c *LayerBatchNorm) Delta () []*SimpleMatrix {
+   return c.DeltaGb
+}
+
+func (c *LayerBatchNorm) CorrectDelta (delta []*SimpleMatrix, offset int) {
+   c.DeltaGb[0] = delta[offset]
+   c.DeltaGb[1] = delta[offset + 1]
+}
+
+func (c *LayerBatchNorm) ParamsUpdate (alpha float64) {
+   c.Gamma = c.Gamma.Add(c.DeltaGb[0], 1, alpha)
+   c.Beta = c.Beta.Add(c.DeltaGb[1], 1, alpha)
+}
+
+func (c *LayerBatchNorm) Replica () (Layer, error) {
+   r := new(LayerBatchNorm)
+   *r = *c
+   r.LayerBase = LayerBase{}
+   r.Gamma = c.Gamma.Clone()
+   r.Beta = c.Beta.Clone()
+   r.RunningMean = c.RunningMean.Clone()
+   r.RunningVar = c.RunningVar.Clone()
+   r.DeltaGb = __clone_all__(c.DeltaGb)
+   r.lastNorm = nil
+   r.lastInvStd = nil
+   return r, nil
+}
+
+
+// Normalize every row (sample) over its columns, then scale and shift with
+// learnable Gamma and Beta. It does not depend on other samples, so it
+// behaves the same in training and evaluation and suits recurrent chains.
+type LayerLayerNorm struct {
+   LayerBase
+   Gamma, Beta *SimpleMatrix
+   DeltaGb []*SimpleMatrix // Gamma, Beta
+   Epsilon float64
+   M, N int
+   lastNorm, lastInvStd *SimpleMatrix
+}
+
+func NewLayerLayerNorm (input_m, input_n int) *LayerLayerNorm {
+   c := new(LayerLayerNorm)
+   c.Gamma = NewSimpleMatrix(1, input_n).Fill(1)
+   c.Beta = NewSimpleMatrix(1, input_n)
+   c.DeltaGb = make([]*SimpleMatrix, 2)
+   c.DeltaGb[0] = NewSimpleMatrix(1, input_n) // dGamma
+   c.DeltaGb[1] = NewSimpleMatrix(1, input_n) // dBeta
+   c.Epsilon = 1e-5
+   c.M = input_m
+   c.N = input_n
+   return c
+}
+
+func (c *LayerLayerNorm) OutputDim () (int, int) {
+   return c.M, c.N
+}
+
+func (c *LayerLayerNorm) InputDim () (int, int) {
+   return c.M, c.N
+}
+
+func (c *LayerLayerNorm) ForwardProp (input *SimpleMatrix) *SimpleMatrix {
+   c.lastInput = input.Clone()
+   c.lastNorm = NewSimpleMatrix(input.M, input.N)
+   c.lastInvStd = NewSimpleMatrix(input.M, 1)
+   for i := input.M - 1; i >= 0; i-- {
+      mean, variance := __norm_mean_var__(input.Data[i])
+      inv_std := 1 / math.Sqrt(variance + c.Epsilon)
+      c.lastInvStd.Data[i][0] = inv_std
+      for j := input.N - 1; j >= 0; j-- {
+         c.lastNorm.Data[i][j] = (input.Data[i][j] - mean) * inv_std
+      }
+   }
+   c.lastOutput = __norm_affine__(c.lastNorm, c.Gamma, c.Beta)
+   return c.lastOutput.Clone()
+}
+
+func (c *LayerLayerNorm) Infer (ctx *InferContext, input *SimpleMatrix) *SimpleMatrix {
+   R := NewSimpleMatrix(input.M, input.N)
+   for i := input.M - 1; i >= 0; i-- {
+      mean, variance := __norm_mean_var__(input.Data[i])
+      inv_std := 1 / math.Sqrt(variance + c.Epsilon)
+      for j := input.N - 1; j >= 0; j-- {
+         R.Data[i][j] = (input.Data[i][j] - mean) * inv_std
+      }
+   }
+   return __norm_affine__(R, c.Gamma, c.Beta)
+}
+
+func (c *LayerLayerNorm) BackwardProp (output_grad *SimpleMatrix) *SimpleMatrix {
+   n := output_grad.N
+   dgamma := NewSimpleMatrix(1, n)
+   dbeta := NewSimpleMatrix(1, n)
+   c.lastGrad = NewSimpleMatrix(output_grad.M, n)
+   for i := output_grad.M - 1; i >= 0; i-- {
+      dnorm := make([]float64, n)
+      for j := n - 1; j >= 0; j-- {
+         dgamma.Data[0][j] += output_grad.Data[i][j] * c.lastNorm.Data[i][j]
+         dbeta.Data[0][j] += output_grad.Data[i][j]
+         dnorm[j] = output_grad.Data[i][j] * c.Gamma.Data[0][j]
+      }
+      copy(c.lastGrad.Data[i], __norm_backward__(dnorm, c.lastNorm.Data[i], c.lastInvStd.Data[i][0]))
+   }
+   c.DeltaGb[0] = dgamma
+   c.DeltaGb[1] = dbeta
+   return c.lastGrad.Clone()
+}
+
+func (c *LayerLayerNorm) Snapshot () interface{} {
+   return []*SimpleMatrix{c.lastNorm, c.lastInvStd}
+}
+
+func (c *LayerLayerNorm) Restore (snapshot interface{}) {
+   s := snapshot.([]*SimpleMatrix)
+   c.lastNorm, c.lastInvStd = s[0], s[1]
+}
+
+func (c *LayerLayerNorm) Params () []NamedMatrix {
+   return __named__([]string{"gamma", "beta"}, []*SimpleMatrix{c.Gamma, c.Beta})
+}
+
+func (c *LayerLayerNorm) DeltaN () int {
+   return 2
+}
+
+func (c *LayerLayerNorm) Delta () []*SimpleMatrix {
+   return c.DeltaGb
+}
+
+func (c *LayerLayerNorm) CorrectDelta (delta []*SimpleMatrix, offset int) {
+   c.DeltaGb[0] = delta[offset]
+   c.DeltaGb[1] = delta[offset + 1]
+}
+
+func (c *LayerLayerNorm) ParamsUpdate (alpha float64) {
+   c.Gamma = c.Gamma.Add(c.DeltaGb[0], 1, alpha)
+   c.Beta = c.Beta.Add(c.DeltaGb[1], 1, alpha)
+}
+
+func (c *LayerLayerNorm) Replica () (Layer, error) {
+   r := new(LayerLayerNorm)
+   *r = *c
+   r.LayerBase = LayerBase{}
+   r.Gamma = c.Gamma.Clone()
+   r.Beta = c.Beta.Clone()
+   r.DeltaGb = __clone_all__(c.DeltaGb)
+   r.lastNorm = nil
+   r.lastInvStd = nil
+   return r, nil
+}
+
+
+func __norm_mean_var__ (x []float64) (float64, float64) {
+   n := float64(len(x))
+   mean := 0.0
+   for _, v := range x {
+      mean += v
+   }
+   mean /= n
+   variance := 0.0
+   for _, v := range x {
+      variance += (v - mean) * (v - mean)
+   }
+   return mean, variance / n
+}
+
+func __norm_affine__ (norm, gamma, beta *SimpleMatrix) *SimpleMatrix {
+   R := NewSimpleMatrix(norm.M, norm.N)
+   for i := norm.M - 1; i >= 0; i-- {
+      for j := norm.N - 1; j >= 0; j-- {
+         R.Data[i][j] = norm.Data[i][j] * gamma.Data[0][j] + beta.Data[0][j]
+      }
+   }
+   return R
+}
+
+// dx = inv_std / n * (n * dnorm - sum(dnorm) - norm * sum(dnorm * norm))
+func __norm_backward__ (dnorm, norm []float64, inv_std float64) []float64 {
+   n := float64(len(dnorm))
+   sum := 0.0
+   sum_norm := 0.0
+   for k, d := range dnorm {
+      sum += d
+      sum_norm += d * norm[k]
+   }
+   dx := make([]float64, len(dnorm))
+   for k, d := range dnorm {
+      dx[k] = inv_std / n * (n * d - sum - norm[k] * sum_norm)
+   }
+   return dx
+}
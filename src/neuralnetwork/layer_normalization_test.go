@@ -0,0 +1,90 @@
+package neuralnetwork
+
+import (
+   "math"
+   "testing"
+)
+
+// Input, Gamma and Beta deltas of a normalization layer against the numeric
+// gradient of 0.5 * |expect - layer(input)|^2.
+func checkTestNormGradient (t *testing.T, layer Layer, Gamma, Beta *SimpleMatrix) {
+   t.Helper()
+   random := NewRand(9)
+   random.FillRandom(Gamma, 0.5, 1.5)
+   random.FillRandom(Beta, -0.5, 0.5)
+   input := random.FillRandom(NewSimpleMatrix(4, 3), -2, 2)
+   expect := random.FillRandom(NewSimpleMatrix(4, 3), -1, 1)
+   loss := func () float64 {
+      d := expect.Add(layer.ForwardProp(input), 1, -1)
+      return 0.5 * d.EltMul(d).EltSum()
+   }
+   grad := layer.BackwardProp(expect.Add(layer.ForwardProp(input), 1, -1))
+   delta := layer.Delta()
+   checkTestDelta(t, "input", input, grad, loss)
+   checkTestDelta(t, "Gamma", Gamma, delta[0], loss)
+   checkTestDelta(t, "Beta", Beta, delta[1], loss)
+}
+
+func TestLayerBatchNormGradient (t *testing.T) {
+   norm := NewLayerBatchNorm(4, 3, 0.9)
+   checkTestNormGradient(t, norm, norm.Gamma, norm.Beta)
+   // evaluation mode: the running statistics are constants
+   norm.SetTraining(false)
+   checkTestNormGradient(t, norm, norm.Gamma, norm.Beta)
+}
+
+func TestLayerLayerNormGradient (t *testing.T) {
+   norm := NewLayerLayerNorm(4, 3)
+   checkTestNormGradient(t, norm, norm.Gamma, norm.Beta)
+}
+
+func TestLayerBatchNormRunningStats (t *testing.T) {
+   norm := NewLayerBatchNorm(3, 2, 0.5)
+   random := NewRand(10)
+   mean := NewSimpleMatrix(1, 2)
+   variance := NewSimpleMatrix(1, 2).Fill(1)
+   for k := 0; k < 3; k++ {
+      input := random.FillRandom(NewSimpleMatrix(3, 2), -1, 3)
+      norm.ForwardProp(input)
+      for j := 0; j < 2; j++ {
+         m, v := __norm_mean_var__(input.Col(j).T().Data[0])
+         mean.Data[0][j] = 0.5 * mean.Data[0][j] + 0.5 * m
+         variance.Data[0][j] = 0.5 * variance.Data[0][j] + 0.5 * v
+      }
+   }
+   if norm.RunningMean.Add(mean, 1, -1).Map(math.Abs).EltMax() > 1e-12 ||
+      norm.RunningVar.Add(variance, 1, -1).Map(math.Abs).EltMax() > 1e-12 {
+      t.Fatalf("running statistics %v %v, expected %v %v", norm.RunningMean.Data, norm.RunningVar.Data, mean.Data, variance.Data)
+   }
+
+   // evaluation mode normalizes with the running statistics and keeps them
+   norm.SetTraining(false)
+   input := random.FillRandom(NewSimpleMatrix(3, 2), -1, 1)
+   expect := NewSimpleMatrix(3, 2)
+   for i := 0; i < 3; i++ {
+      for j := 0; j < 2; j++ {
+         expect.Data[i][j] = (input.Data[i][j] - mean.Data[0][j]) / math.Sqrt(variance.Data[0][j] + norm.Epsilon)
+      }
+   }
+   if norm.ForwardProp(input).Add(expect, 1, -1).Map(math.Abs).EltMax() > 1e-12 {
+      t.Error("evaluation does not use the running statistics")
+   }
+   if norm.Infer(NewInferContext(), input).Add(expect, 1, -1).Map(math.Abs).EltMax() > 1e-12 {
+      t.Error("inference does not use the running statistics")
+   }
+   if norm.RunningMean.Add(mean, 1, -1).Map(math.Abs).EltMax() != 0 {
+      t.Error("evaluation changed the running statistics")
+   }
+
+   // a replica carries its own copy of the running statistics
+   layer, _ := norm.Replica()
+   replica := layer.(*LayerBatchNorm)
+   if replica.Infer(NewInferContext(), input).Add(expect, 1, -1).Map(math.Abs).EltMax() > 1e-12 {
+      t.Error("replica lost the running statistics")
+   }
+   replica.SetTraining(true)
+   replica.ForwardProp(input)
+   if norm.RunningMean.Add(mean, 1, -1).Map(math.Abs).EltMax() != 0 {
+      t.Error("replica shares the running statistics")
+   }
+}
@@ -28,6 +28,15 @@ func (c *LayerPoolMax) LastContribution () *SimpleMatrix {
    return c.lastContribution
 }
 
+// lastContribution is filled in place, so it is copied.
+func (c *LayerPoolMax) Snapshot () interface{} {
+   return c.lastContribution.Clone()
+}
+
+func (c *LayerPoolMax) Restore (snapshot interface{}) {
+   c.lastContribution = snapshot.(*SimpleMatrix).Clone()
+}
+
 func (c *LayerPoolMax) OutputDim () (int, int) {
    m := c.M * c.ItemM
    n := c.N * c.ItemN
@@ -102,6 +111,14 @@ func (c *LayerPoolMax) ForwardProp (input *SimpleMatrix) *SimpleMatrix {
    return c.lastOutput.Clone()
 }
 
+func (c *LayerPoolMax) Infer (ctx *InferContext, input *SimpleMatrix) *SimpleMatrix {
+   out_m, out_n := c.OutputDim()
+   contrib := NewSimpleMatrix(c.lastContribution.M, c.lastContribution.N)
+   return __layer_pool_batch_poolmax__(
+      out_m, out_n, input, c.ItemM, c.ItemN,
+      c.PoolM, c.PoolN, contrib)
+}
+
 func __layer_pool_batch_maxbackward__(
    input, grad *SimpleMatrix, item_m, item_n int,
    pool_m, pool_n int,
@@ -150,3 +167,11 @@ func (c *LayerPoolMax) CorrectDelta (delta []*SimpleMatrix, offset int) {
 
 func (c *LayerPoolMax) ParamsUpdate (alpha float64) {
 }
+
+func (c *LayerPoolMax) Replica () (Layer, error) {
+   r := new(LayerPoolMax)
+   *r = *c
+   r.LayerBase = LayerBase{}
+   r.lastContribution = NewSimpleMatrix(c.lastContribution.M, c.lastContribution.N)
+   return r, nil
+}
@@ -0,0 +1,110 @@
+package neuralnetwork
+
+import "math"
+
+// Adds a position-dependent row to every row (position) of the input: fixed
+// sinusoids, or a learned table when Learned is set.
+type LayerPositionalEncoding struct {
+   LayerBase
+   P *SimpleMatrix
+   DeltaP []*SimpleMatrix
+   Learned bool
+   Initializer Initializer
+}
+
+// P[pos][2i] = sin(pos / 10000^(2i/n)), P[pos][2i+1] = cos(pos / 10000^(2i/n))
+func NewLayerSinusoidalEncoding (input_m, input_n int) *LayerPositionalEncoding {
+   c := new(LayerPositionalEncoding)
+   c.P = NewSimpleMatrix(input_m, input_n)
+   for pos := input_m - 1; pos >= 0; pos-- {
+      for j := input_n - 1; j >= 0; j-- {
+         angle := float64(pos) / math.Pow(10000, float64(j - j % 2) / float64(input_n))
+         if j % 2 == 0 {
+            c.P.Data[pos][j] = math.Sin(angle)
+         } else {
+            c.P.Data[pos][j] = math.Cos(angle)
+         }
+      }
+   }
+   c.DeltaP = make([]*SimpleMatrix, 0)
+   return c
+}
+
+func NewLayerLearnedEncoding (input_m, input_n int, weight_scale float64, initializer ...Initializer) *LayerPositionalEncoding {
+   // initializer default: normal distribution with weight_scale as std
+   c := new(LayerPositionalEncoding)
+   c.Learned = true
+   c.Initializer = __initializer_pick__(initializer, NewNormalInitializer(0, weight_scale))
+   c.P = c.Initializer.Initialize(NewSimpleMatrix(input_m, input_n), input_m, input_n)
+   c.DeltaP = make([]*SimpleMatrix, 1)
+   c.DeltaP[0] = NewSimpleMatrix(input_m, input_n)
+   return c
+}
+
+func (c *LayerPositionalEncoding) Reseed (r *Rand) {
+   if c.Learned {
+      c.P = __initializer_redraw__(c.Initializer, r, NewSimpleMatrix(c.P.M, c.P.N), c.P.M, c.P.N)
+   }
+}
+
+func (c *LayerPositionalEncoding) OutputDim () (int, int) {
+   return c.P.M, c.P.N
+}
+
+func (c *LayerPositionalEncoding) InputDim () (int, int) {
+   return c.P.M, c.P.N
+}
+
+func (c *LayerPositionalEncoding) ForwardProp (input *SimpleMatrix) *SimpleMatrix {
+   c.lastInput = input.Clone()
+   c.lastOutput = input.Add(c.P, 1, 1)
+   return c.lastOutput.Clone()
+}
+
+func (c *LayerPositionalEncoding) Infer (ctx *InferContext, input *SimpleMatrix) *SimpleMatrix {
+   return input.Add(c.P, 1, 1)
+}
+
+func (c *LayerPositionalEncoding) BackwardProp (output_grad *SimpleMatrix) *SimpleMatrix {
+   if c.Learned {
+      c.DeltaP[0] = output_grad.Clone()
+   }
+   c.lastGrad = output_grad.Clone()
+   return c.lastGrad.Clone()
+}
+
+func (c *LayerPositionalEncoding) Params () []NamedMatrix {
+   if !c.Learned {
+      return make([]NamedMatrix, 0)
+   }
+   return __named__([]string{"P"}, []*SimpleMatrix{c.P})
+}
+
+func (c *LayerPositionalEncoding) DeltaN () int {
+   return len(c.DeltaP)
+}
+
+func (c *LayerPositionalEncoding) Delta () []*SimpleMatrix {
+   return c.DeltaP
+}
+
+func (c *LayerPositionalEncoding) CorrectDelta (delta []*SimpleMatrix, offset int) {
+   if c.Learned {
+      c.DeltaP[0] = delta[offset]
+   }
+}
+
+func (c *LayerPositionalEncoding) ParamsUpdate (alpha float64) {
+   if c.Learned {
+      c.P = c.P.Add(c.DeltaP[0], 1, alpha)
+   }
+}
+
+func (c *LayerPositionalEncoding) Replica () (Layer, error) {
+   r := new(LayerPositionalEncoding)
+   *r = *c
+   r.LayerBase = LayerBase{}
+   r.P = c.P.Clone()
+   r.DeltaP = __clone_all__(c.DeltaP)
+   return r, nil
+}
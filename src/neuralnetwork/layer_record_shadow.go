@@ -1,5 +1,9 @@
 package neuralnetwork
 
+import (
+   "fmt"
+)
+
 type ActionOfLayerRecordShadow interface {
    ResetRecord (layer *LayerRecordShadow)
    Record (layer *LayerRecordShadow)
@@ -12,9 +16,14 @@ type ActionOfLayerRecordShadow interface {
 type LayerRecordShadow struct {
    LayerShadow
    cache []*SimpleMatrix
+   // secondary record aligned with cache, e.g. the input of an output record
+   extra []*SimpleMatrix
+   // per-step caches of a SnapshotLayer shadow aligned with cache
+   snapshots []interface{}
    cursor int
    recordM, recordN int
    action ActionOfLayerRecordShadow
+   inference bool
 }
 
 func NewLayerRecordShadow (shadow Layer, record_m, record_n int, action ActionOfLayerRecordShadow) *LayerRecordShadow {
@@ -27,6 +36,19 @@ func NewLayerRecordShadow (shadow Layer, record_m, record_n int, action ActionOf
    return c
 }
 
+func (c *LayerRecordShadow) Reseed (r *Rand) {
+   c.LayerShadow.Reseed(r)
+   if a, ok := c.action.(RandomLayer); ok {
+      a.Reseed(r)
+   }
+}
+
+// Records and actions are bound to one sequence in flight; recurrent layers
+// are not replicated.
+func (c *LayerRecordShadow) Replica () (Layer, error) {
+   return nil, fmt.Errorf("neuralnetwork: recurrent layer of %T cannot be replicated", c.Shadow)
+}
+
 func (c *LayerRecordShadow) SwitchContext (i int) *LayerRecordShadow {
    if i < 0 || i >= len(c.cache) {
       return nil
@@ -55,13 +77,108 @@ func (c *LayerRecordShadow) Prev () *SimpleMatrix {
    return c.cache[c.cursor - 1]
 }
 
+// In inference mode only the latest record is kept so that the layer can be
+// stepped indefinitely with constant memory; back-propagation and parameter
+// updates are not available until inference mode is switched off.
+func (c *LayerRecordShadow) SetInference (inference bool) *LayerRecordShadow {
+   c.inference = inference
+   if inference {
+      c.forget()
+   } else {
+      c.Restart()
+   }
+   return c
+}
+
+// Drop all records and start a new sequence.
+func (c *LayerRecordShadow) Restart () *LayerRecordShadow {
+   c.action.ResetRecord(c)
+   if l, ok := c.Shadow.(SequenceLayer); ok {
+      l.ResetSequence()
+   }
+   return c
+}
+
+func (c *LayerRecordShadow) Inference () bool {
+   return c.inference
+}
+
+func (c *LayerRecordShadow) forget () {
+   c.cache = []*SimpleMatrix{c.Current()}
+   c.extra = []*SimpleMatrix{c.extra[c.cursor]}
+   c.snapshots = []interface{}{nil}
+   c.cursor = 0
+}
+
+func (c *LayerRecordShadow) clear () {
+   c.cache = make([]*SimpleMatrix, 1)
+   c.cache[0] = NewSimpleMatrix(c.recordM, c.recordN)
+   c.extra = make([]*SimpleMatrix, 1)
+   c.snapshots = make([]interface{}, 1)
+   c.cursor = 0
+}
+
+func (c *LayerRecordShadow) push (record, extra *SimpleMatrix) {
+   c.cache = append(c.cache, record)
+   c.extra = append(c.extra, extra)
+   var snapshot interface{}
+   if _, ok := c.Shadow.(SnapshotLayer); ok && !c.inference {
+      snapshot = __snapshot__(c.Shadow)
+   }
+   c.snapshots = append(c.snapshots, snapshot)
+   c.MoveNext()
+}
+
+// Bring the shadow back to the step at the cursor.
+func (c *LayerRecordShadow) restoreSnapshot () {
+   if s, ok := c.snapshots[c.cursor].(layer_snapshot); ok {
+      __restore__(c.Shadow, s)
+   }
+}
+
+func (c *LayerRecordShadow) SaveRecord () *SimpleMatrix {
+   return c.Current().Clone()
+}
+
+func (c *LayerRecordShadow) LoadRecord (record *SimpleMatrix) *LayerRecordShadow {
+   c.cache = []*SimpleMatrix{record.Clone()}
+   c.extra = make([]*SimpleMatrix, 1)
+   c.snapshots = make([]interface{}, 1)
+   c.cursor = 0
+   return c
+}
+
 func (c *LayerRecordShadow) ForwardProp (input *SimpleMatrix) *SimpleMatrix {
    input = c.action.InputPlus(c, input)
    output := c.Shadow.ForwardProp(input)
    c.action.Record(c)
+   if c.inference {
+      c.forget()
+   }
    return output
 }
 
+// One step of the sequence of ctx: its record is kept in ctx, starting from
+// zero like Restart, and the records and cursor of the layer are left alone.
+func (c *LayerRecordShadow) Infer (ctx *InferContext, input *SimpleMatrix) *SimpleMatrix {
+   record, ok := ctx.records[c]
+   if !ok {
+      record = NewSimpleMatrix(c.recordM, c.recordN)
+   }
+   if a, ok := c.action.(inferAction); ok {
+      input = a.InferInputPlus(record, input)
+   }
+   output := InferLayerOf(ctx, c.Shadow, input)
+   ctx.records[c] = output
+   return output
+}
+
+// Actions that feed the record of the previous step into the input, e.g.
+// Recurrence; the record is the output of that step.
+type inferAction interface {
+   InferInputPlus (record, input *SimpleMatrix) *SimpleMatrix
+}
+
 func (c *LayerRecordShadow) BackwardProp (output_grad *SimpleMatrix) *SimpleMatrix {
    output_grad = c.action.GradPlus(c, output_grad)
    delta := c.Shadow.BackwardProp(output_grad)
@@ -70,8 +187,61 @@ func (c *LayerRecordShadow) BackwardProp (output_grad *SimpleMatrix) *SimpleMatr
    return delta
 }
 
+type pendingDeltaAction interface {
+   PendingDelta () []*SimpleMatrix
+   CorrectPendingDelta (delta []*SimpleMatrix, offset int)
+}
+
+// Actions with parameters of their own, e.g. the recurrent weight H; they
+// follow the parameters of the shadow.
+type paramAction interface {
+   Params () []NamedMatrix
+   Delta () []*SimpleMatrix
+   CorrectDelta (delta []*SimpleMatrix, offset int)
+}
+
+func (c *LayerRecordShadow) Params () []NamedMatrix {
+   r := ParamsOf(c.Shadow)
+   if a, ok := c.action.(paramAction); ok {
+      r = append(r, a.Params() ...)
+   }
+   return r
+}
+
+func (c *LayerRecordShadow) DeltaN () int {
+   n := c.Shadow.DeltaN()
+   if a, ok := c.action.(paramAction); ok {
+      n += len(a.Delta())
+   }
+   return n
+}
+
+func (c *LayerRecordShadow) Delta () []*SimpleMatrix {
+   var r []*SimpleMatrix
+   if a, ok := c.action.(pendingDeltaAction); ok && a.PendingDelta() != nil {
+      r = append(r, a.PendingDelta() ...)
+   } else {
+      r = append(r, c.Shadow.Delta() ...)
+   }
+   if a, ok := c.action.(paramAction); ok {
+      r = append(r, a.Delta() ...)
+   }
+   return r
+}
+
+func (c *LayerRecordShadow) CorrectDelta (delta []*SimpleMatrix, offset int) {
+   if a, ok := c.action.(paramAction); ok {
+      a.CorrectDelta(delta, offset + c.Shadow.DeltaN())
+   }
+   if a, ok := c.action.(pendingDeltaAction); ok && a.PendingDelta() != nil {
+      a.CorrectPendingDelta(delta, offset)
+      return
+   }
+   c.Shadow.CorrectDelta(delta, offset)
+}
+
 func (c *LayerRecordShadow) ParamsUpdate (alpha float64) {
-   if c.cursor > 0 {
+   if c.inference || c.cursor > 0 {
       return
    }
    // record and move cursor forward
@@ -80,7 +250,7 @@ func (c *LayerRecordShadow) ParamsUpdate (alpha float64) {
    // then update params with aggregated delta
    c.action.DeltaApply(c, alpha)
    c.Shadow.ParamsUpdate(alpha)
-   c.action.ResetRecord(c)
+   c.Restart()
 }
 
 
@@ -89,14 +259,11 @@ type NopActionOfLayerRecordShadow struct {
 }
 
 func (a *NopActionOfLayerRecordShadow) ResetRecord (c *LayerRecordShadow) {
-   c.cache = make([]*SimpleMatrix, 1)
-   c.cache[0] = NewSimpleMatrix(c.recordM, c.recordN)
-   c.cursor = 0
+   c.clear()
 }
 
 func (a *NopActionOfLayerRecordShadow) Record (c *LayerRecordShadow) {
-   c.cache = append(c.cache, nil)
-   c.MoveNext()
+   c.push(nil, nil)
 }
 
 func (a *NopActionOfLayerRecordShadow) InputPlus (c *LayerRecordShadow, input *SimpleMatrix) *SimpleMatrix {
@@ -120,12 +287,12 @@ type RecordInputOfLayerRecordShadow struct {
 
 func (a *RecordInputOfLayerRecordShadow) GradPlus (c *LayerRecordShadow, grad *SimpleMatrix) *SimpleMatrix {
    c.LoadLastInput(c.Current())
+   c.restoreSnapshot()
    return grad
 }
 
 func (a *RecordInputOfLayerRecordShadow) Record (c *LayerRecordShadow) {
-   c.cache = append(c.cache, c.LastInput())
-   c.MoveNext()
+   c.push(c.LastInput(), nil)
 }
 
 
@@ -134,11 +301,20 @@ type RecordOutputOfLayerRecordShadow struct {
 }
 
 func (a *RecordOutputOfLayerRecordShadow) GradPlus (c *LayerRecordShadow, grad *SimpleMatrix) *SimpleMatrix {
-   c.LoadLastOutput(c.Current())
+   c.loadOutputRecord()
    return grad
 }
 
+// Keep the input too, so that derivatives defined on the input (e.g. ReLU)
+// see the right step during back-propagation.
 func (a *RecordOutputOfLayerRecordShadow) Record (c *LayerRecordShadow) {
-   c.cache = append(c.cache, c.LastOutput())
-   c.MoveNext()
+   c.push(c.LastOutput(), c.LastInput())
+}
+
+func (c *LayerRecordShadow) loadOutputRecord () {
+   c.LoadLastOutput(c.Current())
+   if input := c.extra[c.cursor]; input != nil {
+      c.LoadLastInput(input)
+   }
+   c.restoreSnapshot()
 }
@@ -3,33 +3,46 @@ package neuralnetwork
 type RecurrenceOfLayerRecordShadow struct {
    RecordOutputOfLayerRecordShadow
    H, DeltaH *SimpleMatrix
+   Initializer Initializer
    lastDelta *SimpleMatrix
 }
 
-func (a *RecurrenceOfLayerRecordShadow) Init (record_m, record_n int) *RecurrenceOfLayerRecordShadow {
-   a.H = NewSimpleMatrix(record_m, record_n).FillRandom(-1, 1)
+func (a *RecurrenceOfLayerRecordShadow) Init (record_m, record_n int, initializer ...Initializer) *RecurrenceOfLayerRecordShadow {
+   // initializer default: orthogonal
+   a.Initializer = __initializer_pick__(initializer, NewOrthogonalInitializer(1))
+   a.H = a.Initializer.Initialize(NewSimpleMatrix(record_m, record_n), record_m, record_n)
    return a
 }
 
+func (a *RecurrenceOfLayerRecordShadow) Reseed (r *Rand) {
+   if a.Initializer == nil {
+      // filled by InitFill
+      return
+   }
+   a.H = __initializer_redraw__(a.Initializer, r, NewSimpleMatrix(a.H.M, a.H.N), a.H.M, a.H.N)
+}
+
 func (a *RecurrenceOfLayerRecordShadow) InitFill (h *SimpleMatrix) *RecurrenceOfLayerRecordShadow {
    a.H = h
    return a
 }
 
 func (a *RecurrenceOfLayerRecordShadow) ResetRecord (c *LayerRecordShadow) {
-   c.cache = make([]*SimpleMatrix, 1)
-   c.cache[0] = NewSimpleMatrix(c.recordM, c.recordN)
-   c.cursor = 0
+   c.clear()
    a.lastDelta = NewSimpleMatrix(c.recordM, c.recordN)
    a.DeltaH = NewSimpleMatrix(c.recordN, c.recordN)
 }
 
 func (a *RecurrenceOfLayerRecordShadow) InputPlus (c *LayerRecordShadow, input *SimpleMatrix) *SimpleMatrix {
-   return input.Add(c.Current().Dot(a.H), 1, 1)
+   return a.InferInputPlus(c.Current(), input)
+}
+
+func (a *RecurrenceOfLayerRecordShadow) InferInputPlus (record, input *SimpleMatrix) *SimpleMatrix {
+   return input.Add(record.Dot(a.H), 1, 1)
 }
 
 func (a *RecurrenceOfLayerRecordShadow) GradPlus (c *LayerRecordShadow, grad *SimpleMatrix) *SimpleMatrix {
-   c.LoadLastOutput(c.Current())
+   c.loadOutputRecord()
    return grad.Add(a.lastDelta.Dot(a.H.T()), 1, 1)
 }
 
@@ -42,44 +55,89 @@ func (a *RecurrenceOfLayerRecordShadow) DeltaApply (c *LayerRecordShadow, alpha
    a.H = a.H.Add(a.DeltaH, 1, alpha)
 }
 
+func (a *RecurrenceOfLayerRecordShadow) Params () []NamedMatrix {
+   return []NamedMatrix{{Name: "H", Value: a.H}}
+}
 
-type RecordOutputDelayUpdateOfLayerRecordShadow struct {
-   RecordOutputOfLayerRecordShadow
+func (a *RecurrenceOfLayerRecordShadow) Delta () []*SimpleMatrix {
+   return []*SimpleMatrix{a.DeltaH}
+}
+
+func (a *RecurrenceOfLayerRecordShadow) CorrectDelta (delta []*SimpleMatrix, offset int) {
+   a.DeltaH = delta[offset]
+}
+
+
+// Sum of the shadow deltas of every time step, applied once per sequence.
+// While a sum is pending, Delta/CorrectDelta of the layer work on it, so that
+// clipping a recurrent chain before Update clips what is applied.
+type DelayDeltaOfLayerRecordShadow struct {
    Delta []*SimpleMatrix
 }
 
-func (a *RecordOutputDelayUpdateOfLayerRecordShadow) DeltaUpdate (c *LayerRecordShadow) {
+func (a *DelayDeltaOfLayerRecordShadow) accumulate (c *LayerRecordShadow) {
+   delta := c.Shadow.Delta()
    if a.Delta == nil {
-      a.Delta = c.Delta()
-   } else {
-      delta := c.Delta()
-      for i, d := range delta {
-         a.Delta[i] = a.Delta[i].Add(d, 1, 1)
-      }
+      // copy: the shadow may keep updating its own delta matrices
+      a.Delta = __clone_all__(delta)
+      return
+   }
+   for i, d := range delta {
+      a.Delta[i] = a.Delta[i].Add(d, 1, 1)
+   }
+}
+
+func (a *DelayDeltaOfLayerRecordShadow) apply (c *LayerRecordShadow) {
+   if a.Delta != nil {
+      c.Shadow.CorrectDelta(a.Delta, 0)
+   }
+   a.Delta = nil
+}
+
+func (a *DelayDeltaOfLayerRecordShadow) PendingDelta () []*SimpleMatrix {
+   return a.Delta
+}
+
+func (a *DelayDeltaOfLayerRecordShadow) CorrectPendingDelta (delta []*SimpleMatrix, offset int) {
+   for i := range a.Delta {
+      a.Delta[i] = delta[offset + i]
    }
 }
 
+
+type RecordOutputDelayUpdateOfLayerRecordShadow struct {
+   RecordOutputOfLayerRecordShadow
+   DelayDeltaOfLayerRecordShadow
+}
+
+func (a *RecordOutputDelayUpdateOfLayerRecordShadow) ResetRecord (c *LayerRecordShadow) {
+   c.clear()
+   a.Delta = nil
+}
+
+func (a *RecordOutputDelayUpdateOfLayerRecordShadow) DeltaUpdate (c *LayerRecordShadow) {
+   a.accumulate(c)
+}
+
 func (a *RecordOutputDelayUpdateOfLayerRecordShadow) DeltaApply (c *LayerRecordShadow, alpha float64) {
-   c.CorrectDelta(a.Delta, 0)
+   a.apply(c)
 }
 
 
 type RecordInputDelayUpdateOfLayerRecordShadow struct{
    RecordInputOfLayerRecordShadow
-   Delta []*SimpleMatrix
+   DelayDeltaOfLayerRecordShadow
+}
+
+func (a *RecordInputDelayUpdateOfLayerRecordShadow) ResetRecord (c *LayerRecordShadow) {
+   c.clear()
+   a.Delta = nil
 }
 
 func (a *RecordInputDelayUpdateOfLayerRecordShadow) DeltaUpdate (c *LayerRecordShadow) {
-   if a.Delta == nil {
-      a.Delta = c.Delta()
-   } else {
-      delta := c.Delta()
-      for i, d := range delta {
-         a.Delta[i] = a.Delta[i].Add(d, 1, 1)
-      }
-   }
+   a.accumulate(c)
 }
 
 func (a *RecordInputDelayUpdateOfLayerRecordShadow) DeltaApply (c *LayerRecordShadow, alpha float64) {
-   c.CorrectDelta(a.Delta, 0)
+   a.apply(c)
 }
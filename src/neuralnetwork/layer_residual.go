@@ -0,0 +1,161 @@
+package neuralnetwork
+
+import "fmt"
+
+// Skip connection around a nested chain: output = input + chain(input), or
+// Projection(input) + chain(input) when the chain changes the dims.
+type LayerResidual struct {
+   LayerBase
+   Chain *NeuralChain
+   Projection *LayerLinear
+}
+
+func NewLayerResidual (chain *NeuralChain, projection *LayerLinear) (*LayerResidual, error) {
+   // projection: nil for identity, which needs a chain that keeps the dims
+   in_m, in_n := chain.InputDim()
+   if in_m == 0 && in_n == 0 && len(chain.Layers) > 0 {
+      in_m, in_n = chain.Layers[0].InputDim()
+   }
+   out_m, out_n := chain.OutputDim()
+   if projection == nil {
+      if in_m != out_m || in_n != out_n {
+         return nil, fmt.Errorf("neuralnetwork: residual chain maps %dx%d to %dx%d without a projection", in_m, in_n, out_m, out_n)
+      }
+   } else {
+      pin_m, pin_n := projection.InputDim()
+      pout_m, pout_n := projection.OutputDim()
+      if pin_m != in_m || pin_n != in_n || pout_m != out_m || pout_n != out_n {
+         return nil, fmt.Errorf(
+            "neuralnetwork: residual projection maps %dx%d to %dx%d, chain %dx%d to %dx%d",
+            pin_m, pin_n, pout_m, pout_n, in_m, in_n, out_m, out_n,
+         )
+      }
+   }
+   c := new(LayerResidual)
+   c.Chain = chain
+   c.Projection = projection
+   return c, nil
+}
+
+func (c *LayerResidual) OutputDim () (int, int) {
+   return c.Chain.OutputDim()
+}
+
+func (c *LayerResidual) InputDim () (int, int) {
+   if c.Projection != nil {
+      return c.Projection.InputDim()
+   }
+   return c.Chain.InputDim()
+}
+
+func (c *LayerResidual) ForwardProp (input *SimpleMatrix) *SimpleMatrix {
+   c.lastInput = input.Clone()
+   skip := input
+   if c.Projection != nil {
+      skip = c.Projection.ForwardProp(input)
+   }
+   c.lastOutput = c.Chain.ForwardProp(input).Add(skip, 1, 1)
+   return c.lastOutput.Clone()
+}
+
+func (c *LayerResidual) Infer (ctx *InferContext, input *SimpleMatrix) *SimpleMatrix {
+   skip := input
+   if c.Projection != nil {
+      skip = c.Projection.Infer(ctx, input)
+   }
+   return c.Chain.Infer(ctx, input).Add(skip, 1, 1)
+}
+
+func (c *LayerResidual) BackwardProp (output_grad *SimpleMatrix) *SimpleMatrix {
+   skip := output_grad
+   if c.Projection != nil {
+      skip = c.Projection.BackwardProp(output_grad)
+   }
+   c.lastGrad = c.Chain.BackwardProp(output_grad).Add(skip, 1, 1)
+   return c.lastGrad.Clone()
+}
+
+func (c *LayerResidual) Snapshot () interface{} {
+   s := []layer_snapshot{__snapshot__(c.Chain)}
+   if c.Projection != nil {
+      s = append(s, __snapshot__(c.Projection))
+   }
+   return s
+}
+
+func (c *LayerResidual) Restore (snapshot interface{}) {
+   s := snapshot.([]layer_snapshot)
+   __restore__(c.Chain, s[0])
+   if c.Projection != nil {
+      __restore__(c.Projection, s[1])
+   }
+}
+
+func (c *LayerResidual) Params () []NamedMatrix {
+   r := c.Chain.Params()
+   if c.Projection != nil {
+      r = append(r, __prefix_named__("projection", c.Projection.Params()) ...)
+   }
+   return r
+}
+
+func (c *LayerResidual) DeltaN () int {
+   n := c.Chain.DeltaN()
+   if c.Projection != nil {
+      n += c.Projection.DeltaN()
+   }
+   return n
+}
+
+func (c *LayerResidual) Delta () []*SimpleMatrix {
+   r := c.Chain.Delta()
+   if c.Projection != nil {
+      r = append(r, c.Projection.Delta() ...)
+   }
+   return r
+}
+
+func (c *LayerResidual) CorrectDelta (delta []*SimpleMatrix, offset int) {
+   c.Chain.CorrectDelta(delta, offset)
+   if c.Projection != nil {
+      c.Projection.CorrectDelta(delta, offset + c.Chain.DeltaN())
+   }
+}
+
+func (c *LayerResidual) ParamsUpdate (alpha float64) {
+   c.Chain.ParamsUpdate(alpha)
+   if c.Projection != nil {
+      c.Projection.ParamsUpdate(alpha)
+   }
+}
+
+func (c *LayerResidual) SetTraining (training bool) {
+   c.Chain.SetTraining(training)
+}
+
+func (c *LayerResidual) SetMask (mask *SimpleMatrix) {
+   c.Chain.SetMask(mask)
+}
+
+func (c *LayerResidual) Reseed (r *Rand) {
+   c.Chain.Reseed(r)
+   if c.Projection != nil {
+      c.Projection.Reseed(r)
+   }
+}
+
+func (c *LayerResidual) Replica () (Layer, error) {
+   chain, err := c.Chain.Replica()
+   if err != nil {
+      return nil, err
+   }
+   var projection *LayerLinear
+   if c.Projection != nil {
+      layer, err := c.Projection.Replica()
+      if err != nil {
+         return nil, err
+      }
+      projection = layer.(*LayerLinear)
+   }
+   return NewLayerResidual(chain.(*NeuralChain), projection)
+}
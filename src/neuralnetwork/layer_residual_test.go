@@ -0,0 +1,50 @@
+package neuralnetwork
+
+import (
+   "testing"
+)
+
+func TestLayerResidualGradient (t *testing.T) {
+   inner := NewNeuralChain().DefineInputDim(1, 3)
+   inner.AddLayer(NewLayerLinear(1, 3, 4, 0, false))
+   inner.AddLayer(MustLayerActivation(1, 4, "tanh"))
+   block, err := NewLayerResidual(inner, NewLayerLinear(1, 3, 4, 0, false))
+   if err != nil {
+      t.Fatal(err)
+   }
+   n := NewNeuralChain()
+   n.AddLayer(block)
+   identity := NewNeuralChain().DefineInputDim(1, 4)
+   identity.AddLayer(NewLayerLinear(1, 4, 4, 0, false))
+   identity.AddLayer(MustLayerActivation(1, 4, "relu"))
+   identity_block, err := NewLayerResidual(identity, nil)
+   if err != nil {
+      t.Fatal(err)
+   }
+   n.AddLayer(identity_block)
+   n.AddLayer(NewLayerLinear(1, 4, 1, 0, false))
+   n.Seed(5)
+
+   input := NewSimpleMatrix(1, 3).FillElt([]float64{0.3, -0.6, 0.9})
+   expect := NewSimpleMatrix(1, 1).FillElt([]float64{0.25})
+   checkTestLinearDelta(t, n, []*LayerLinear{
+      inner.Layers[0].(*LayerLinear), block.Projection, identity.Layers[0].(*LayerLinear),
+   }, input, expect, nil)
+}
+
+func TestLayerResidualDims (t *testing.T) {
+   inner := NewNeuralChain().DefineInputDim(1, 3)
+   inner.AddLayer(NewLayerLinear(1, 3, 4, 0, false))
+   if _, err := NewLayerResidual(inner, nil); err == nil {
+      t.Error("identity skip around a 1x3 -> 1x4 chain")
+   }
+   if _, err := NewLayerResidual(inner, NewLayerLinear(1, 3, 5, 0, false)); err == nil {
+      t.Error("1x3 -> 1x5 projection around a 1x3 -> 1x4 chain")
+   }
+   // input dims from the first layer when the chain does not define them
+   square := NewNeuralChain()
+   square.AddLayer(NewLayerLinear(1, 3, 3, 0, false))
+   if _, err := NewLayerResidual(square, nil); err != nil {
+      t.Error(err)
+   }
+}
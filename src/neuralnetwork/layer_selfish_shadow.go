@@ -47,11 +47,19 @@ func (c *LayerSelfishShadow) ForwardProp (input *SimpleMatrix) *SimpleMatrix {
    return c.lastOutput.Clone()
 }
 
+func (c *LayerSelfishShadow) Infer (ctx *InferContext, input *SimpleMatrix) *SimpleMatrix {
+   return InferLayerOf(ctx, c.Shadow, input)
+}
+
 func (c *LayerSelfishShadow) BackwardProp (output_grad *SimpleMatrix) *SimpleMatrix {
    c.lastGrad = c.Shadow.BackwardProp(output_grad).Clone()
    return c.lastGrad.Clone()
 }
 
+func (c *LayerSelfishShadow) Params () []NamedMatrix {
+   return ParamsOf(c.Shadow)
+}
+
 func (c *LayerSelfishShadow) DeltaN () int {
    return c.Shadow.DeltaN()
 }
@@ -67,3 +75,23 @@ func (c *LayerSelfishShadow) CorrectDelta (delta []*SimpleMatrix, offset int) {
 func (c *LayerSelfishShadow) ParamsUpdate (alpha float64) {
    c.Shadow.ParamsUpdate(alpha)
 }
+
+func (c *LayerSelfishShadow) SetTraining (training bool) {
+   if l, ok := c.Shadow.(ModeLayer); ok {
+      l.SetTraining(training)
+   }
+}
+
+func (c *LayerSelfishShadow) Reseed (r *Rand) {
+   if l, ok := c.Shadow.(RandomLayer); ok {
+      l.Reseed(r)
+   }
+}
+
+func (c *LayerSelfishShadow) Replica () (Layer, error) {
+   shadow, err := ReplicaOf(c.Shadow)
+   if err != nil {
+      return nil, err
+   }
+   return NewLayerSelfishShadow(shadow), nil
+}
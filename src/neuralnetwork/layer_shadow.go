@@ -31,6 +31,19 @@ func (c *LayerShadow) LoadLastOutput (output *SimpleMatrix) {
    c.Shadow.LoadLastOutput(output)
 }
 
+func (c *LayerShadow) Snapshot () interface{} {
+   if l, ok := c.Shadow.(SnapshotLayer); ok {
+      return l.Snapshot()
+   }
+   return nil
+}
+
+func (c *LayerShadow) Restore (snapshot interface{}) {
+   if l, ok := c.Shadow.(SnapshotLayer); ok {
+      l.Restore(snapshot)
+   }
+}
+
 func (c *LayerShadow) OutputDim () (int, int) {
    return c.Shadow.OutputDim()
 }
@@ -43,10 +56,18 @@ func (c *LayerShadow) ForwardProp (input *SimpleMatrix) *SimpleMatrix {
    return c.Shadow.ForwardProp(input)
 }
 
+func (c *LayerShadow) Infer (ctx *InferContext, input *SimpleMatrix) *SimpleMatrix {
+   return InferLayerOf(ctx, c.Shadow, input)
+}
+
 func (c *LayerShadow) BackwardProp (output_grad *SimpleMatrix) *SimpleMatrix {
    return c.Shadow.BackwardProp(output_grad)
 }
 
+func (c *LayerShadow) Params () []NamedMatrix {
+   return ParamsOf(c.Shadow)
+}
+
 func (c *LayerShadow) DeltaN () int {
    return c.Shadow.DeltaN()
 }
@@ -62,3 +83,23 @@ func (c *LayerShadow) CorrectDelta (delta []*SimpleMatrix, offset int) {
 func (c *LayerShadow) ParamsUpdate (alpha float64) {
    c.Shadow.ParamsUpdate(alpha)
 }
+
+func (c *LayerShadow) SetTraining (training bool) {
+   if l, ok := c.Shadow.(ModeLayer); ok {
+      l.SetTraining(training)
+   }
+}
+
+func (c *LayerShadow) Reseed (r *Rand) {
+   if l, ok := c.Shadow.(RandomLayer); ok {
+      l.Reseed(r)
+   }
+}
+
+func (c *LayerShadow) Replica () (Layer, error) {
+   shadow, err := ReplicaOf(c.Shadow)
+   if err != nil {
+      return nil, err
+   }
+   return NewLayerShadow(shadow), nil
+}
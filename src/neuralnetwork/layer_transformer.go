@@ -0,0 +1,55 @@
+package neuralnetwork
+
+// Transformer encoder block (post-norm):
+//    X1 = LayerNorm(X + MultiHeadAttention(X))
+//    Y  = LayerNorm(X1 + Linear(relu(Linear(X1))))
+// built from LayerResidual and LayerLayerNorm; SetMask reaches the attention.
+type LayerTransformerEncoder struct {
+   NeuralChain
+   Attention *LayerMultiHeadAttention
+}
+
+func NewLayerTransformerEncoder (input_m, input_n, heads, hidden_n int, gain float64) (*LayerTransformerEncoder, error) {
+   // hidden_n: width of the feed-forward part
+   // gain: of the Xavier initialization of the linear layers
+   attention, err := NewLayerMultiHeadAttention(input_m, input_n, heads, gain)
+   if err != nil {
+      return nil, err
+   }
+   c := new(LayerTransformerEncoder)
+   c.Layers = make([]Layer, 0)
+   c.DefineInputDim(input_m, input_n)
+   c.Attention = attention
+
+   self_attention := NewNeuralChain().DefineInputDim(input_m, input_n)
+   self_attention.AddLayer(attention)
+   attention_block, err := NewLayerResidual(self_attention, nil)
+   if err != nil {
+      return nil, err
+   }
+   c.AddLayer(attention_block)
+   c.AddLayer(NewLayerLayerNorm(input_m, input_n))
+
+   feed_forward := NewNeuralChain().DefineInputDim(input_m, input_n)
+   feed_forward.AddLayer(NewLayerLinear(input_m, input_n, hidden_n, 0, true, NewXavierUniform(gain)))
+   feed_forward.AddLayer(MustLayerActivation(input_m, hidden_n, "relu"))
+   feed_forward.AddLayer(NewLayerLinear(input_m, hidden_n, input_n, 0, true, NewXavierUniform(gain)))
+   feed_forward_block, err := NewLayerResidual(feed_forward, nil)
+   if err != nil {
+      return nil, err
+   }
+   c.AddLayer(feed_forward_block)
+   c.AddLayer(NewLayerLayerNorm(input_m, input_n))
+   return c, nil
+}
+
+func (c *LayerTransformerEncoder) Replica () (Layer, error) {
+   chain, err := c.NeuralChain.Replica()
+   if err != nil {
+      return nil, err
+   }
+   r := new(LayerTransformerEncoder)
+   r.NeuralChain = *chain.(*NeuralChain)
+   r.Attention = r.Layers[0].(*LayerResidual).Chain.Layers[0].(*LayerMultiHeadAttention)
+   return r, nil
+}
@@ -3,7 +3,6 @@ package neuralnetwork
 import (
    "fmt"
    "math"
-   "math/rand"
 )
 
 type SimpleMatrix struct {
@@ -60,21 +59,11 @@ func (X *SimpleMatrix) FillElt (x []float64) *SimpleMatrix {
 }
 
 func (X *SimpleMatrix) FillRandom (a, b float64) *SimpleMatrix {
-   for i := X.M - 1; i >= 0; i-- {
-      for j := X.N - 1; j >= 0; j-- {
-         X.Data[i][j] = rand.Float64() * (b - a) + a
-      }
-   }
-   return X
+   return default_rand.FillRandom(X, a, b)
 }
 
-func (X *SimpleMatrix) FillGuassian (mu, std float64) *SimpleMatrix {
-   for i := X.M - 1; i >= 0; i-- {
-      for j := X.N - 1; j >= 0; j-- {
-         X.Data[i][j] = RandomGuassian(mu, std)
-      }
-   }
-   return X
+func (X *SimpleMatrix) FillGaussian (mu, std float64) *SimpleMatrix {
+   return default_rand.FillGaussian(X, mu, std)
 }
 
 func (X *SimpleMatrix) FillWindow (y, x int, Y *SimpleMatrix) *SimpleMatrix {
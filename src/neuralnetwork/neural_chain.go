@@ -1,12 +1,16 @@
 package neuralnetwork
 
-import "math"
+import (
+   "fmt"
+   "math"
+)
 
 type NeuralChain struct {
    LayerBase
    NeuralNetwork
    Layers []Layer
    InputM, InputN int
+   Rand *Rand
 }
 
 func NewNeuralChain () *NeuralChain {
@@ -33,6 +37,20 @@ func (n *NeuralChain) Predict (input *SimpleMatrix) *SimpleMatrix {
    return X_next
 }
 
+// Stateless counterpart of Predict: activations are kept in a fresh
+// InferContext, so concurrent calls on one trained chain do not race.
+func (n *NeuralChain) PredictSafe (input *SimpleMatrix) *SimpleMatrix {
+   return n.Infer(NewInferContext(), input)
+}
+
+func (c *NeuralChain) Infer (ctx *InferContext, input *SimpleMatrix) *SimpleMatrix {
+   X_next := input
+   for _, layer := range c.Layers {
+      X_next = InferLayerOf(ctx, layer, X_next)
+   }
+   return X_next
+}
+
 func (n *NeuralChain) Learn (predict *SimpleMatrix, expect *SimpleMatrix) NeuralNetwork {
    m := len(n.Layers)
    grad_next := expect.Add(predict, 1, -1)
@@ -42,6 +60,35 @@ func (n *NeuralChain) Learn (predict *SimpleMatrix, expect *SimpleMatrix) Neural
    return n
 }
 
+// Mini-batch training: the deltas of every sample are summed and applied
+// once through CorrectDelta.
+func (n *NeuralChain) FitBatch (inputs, expects []*SimpleMatrix, alpha float64) NeuralNetwork {
+   if delta := n.accumulateDelta(inputs, expects); delta != nil {
+      n.CorrectDelta(delta, 0)
+   }
+   return n.Update(alpha)
+}
+
+// Forward and backward every sample and return the sum of their deltas;
+// layer deltas are reset after each sample so that layers accumulating
+// their own delta are not counted twice.
+func (n *NeuralChain) accumulateDelta (inputs, expects []*SimpleMatrix) []*SimpleMatrix {
+   var sum []*SimpleMatrix
+   for i, input := range inputs {
+      n.Learn(n.Predict(input), expects[i])
+      delta := n.Delta()
+      if sum == nil {
+         sum = __clone_all__(delta)
+      } else {
+         for k, d := range delta {
+            sum[k] = sum[k].Add(d, 1, 1)
+         }
+      }
+      n.ZeroGrad()
+   }
+   return sum
+}
+
 func (n *NeuralChain) Update (alpha float64) NeuralNetwork {
    m := len(n.Layers)
    for i := m - 1; i >= 0; i-- {
@@ -50,6 +97,65 @@ func (n *NeuralChain) Update (alpha float64) NeuralNetwork {
    return n
 }
 
+// Redraw all random state of the chain (weights, dropout masks) from a Rand
+// seeded with seed, so that the same seed gives the same weights and training
+// trajectory.
+func (c *NeuralChain) Seed (seed int64) *NeuralChain {
+   c.Reseed(NewRand(seed))
+   return c
+}
+
+func (c *NeuralChain) Reseed (r *Rand) {
+   c.Rand = r
+   for _, layer := range c.Layers {
+      if l, ok := layer.(RandomLayer); ok {
+         l.Reseed(r)
+      }
+   }
+}
+
+func (c *NeuralChain) Replica () (Layer, error) {
+   r := NewNeuralChain()
+   r.DefineInputDim(c.InputM, c.InputN)
+   if c.Rand != nil {
+      r.Rand = NewRand(c.Rand.Int63())
+   }
+   for _, layer := range c.Layers {
+      replica, err := ReplicaOf(layer)
+      if err != nil {
+         return nil, err
+      }
+      r.AddLayer(replica)
+   }
+   return r, nil
+}
+
+func (c *NeuralChain) SetTraining (training bool) {
+   for _, layer := range c.Layers {
+      if l, ok := layer.(ModeLayer); ok {
+         l.SetTraining(training)
+      }
+   }
+}
+
+func (c *NeuralChain) SetMask (mask *SimpleMatrix) {
+   for _, layer := range c.Layers {
+      if l, ok := layer.(MaskLayer); ok {
+         l.SetMask(mask)
+      }
+   }
+}
+
+func (c *NeuralChain) TrainMode () *NeuralChain {
+   c.SetTraining(true)
+   return c
+}
+
+func (c *NeuralChain) EvalMode () *NeuralChain {
+   c.SetTraining(false)
+   return c
+}
+
 func (n *NeuralChain) Error (predict, expect *SimpleMatrix) float64 {
    return expect.Add(predict, 1, -1).Map(math.Abs).EltSum() / float64(predict.M * predict.N)
 }
@@ -72,6 +178,22 @@ func (c *NeuralChain) InputDim () (int, int) {
    return c.InputM, c.InputN
 }
 
+// Caches of every layer, so that a recurrent wrapper can back-propagate an
+// earlier time step through the chain.
+func (c *NeuralChain) Snapshot () interface{} {
+   layers := make([]layer_snapshot, len(c.Layers))
+   for i, layer := range c.Layers {
+      layers[i] = __snapshot__(layer)
+   }
+   return layers
+}
+
+func (c *NeuralChain) Restore (snapshot interface{}) {
+   for i, s := range snapshot.([]layer_snapshot) {
+      __restore__(c.Layers[i], s)
+   }
+}
+
 func (c *NeuralChain) ForwardProp (input *SimpleMatrix) *SimpleMatrix {
    c.lastInput = input.Clone()
    c.lastOutput = c.Predict(c.lastInput)
@@ -104,7 +226,39 @@ func (c *NeuralChain) Delta () []*SimpleMatrix {
       }
       r = append(r, layer.Delta() ...)
    }
-   return make([]*SimpleMatrix, 0)
+   return r
+}
+
+// Parameters of all layers, named "layer<index>.<name>", aligned with Delta().
+func (c *NeuralChain) Params () []NamedMatrix {
+   r := make([]NamedMatrix, 0)
+   for i, layer := range c.Layers {
+      r = append(r, __prefix_named__(fmt.Sprintf("layer%d", i), ParamsOf(layer)) ...)
+   }
+   return r
+}
+
+// Deltas of all layers under the names of Params(); see GradsOf.
+func (c *NeuralChain) Grads () []NamedMatrix {
+   r := make([]NamedMatrix, 0)
+   for i, layer := range c.Layers {
+      r = append(r, __prefix_named__(fmt.Sprintf("layer%d", i), GradsOf(layer)) ...)
+   }
+   return r
+}
+
+func (c *NeuralChain) ZeroGrad () *NeuralChain {
+   ZeroGradOf(c)
+   return c
+}
+
+func (c *NeuralChain) ClipGradNorm (max_norm float64) float64 {
+   return ClipGradNormOf(c, max_norm)
+}
+
+func (c *NeuralChain) ClipGradValue (limit float64) *NeuralChain {
+   ClipGradValueOf(c, limit)
+   return c
 }
 
 func (c *NeuralChain) CorrectLayerDelta (delta []*SimpleMatrix, offset, layerIndex int) {
@@ -0,0 +1,105 @@
+package neuralnetwork
+
+import "math"
+
+// Character-level language model on top of RecurrentModel: every character
+// is one-hot encoded and the model learns to predict the next one.
+type CharRecurrentModel struct {
+   RecurrentModel
+   Chars []rune
+   index map[rune]int
+}
+
+func NewCharRecurrentModel (corpus string, hidden_n int, gain float64) *CharRecurrentModel {
+   c := new(CharRecurrentModel)
+   c.index = make(map[rune]int)
+   for _, ch := range corpus {
+      if _, ok := c.index[ch]; ok {
+         continue
+      }
+      c.index[ch] = len(c.Chars)
+      c.Chars = append(c.Chars, ch)
+   }
+   n := len(c.Chars)
+   model := NewRecurrentModel(n, hidden_n, n, gain, "tanh", "softmax")
+   c.RecurrentModel = *model
+   return c
+}
+
+func (c *CharRecurrentModel) Encode (ch rune) *SimpleMatrix {
+   R := NewSimpleMatrix(1, len(c.Chars))
+   if i, ok := c.index[ch]; ok {
+      R.Data[0][i] = 1
+   }
+   return R
+}
+
+// Train one pass over text, split into chunks of seq_len characters;
+// returns the mean cross entropy per predicted character.
+func (c *CharRecurrentModel) TrainText (text string, seq_len int, alpha float64) float64 {
+   chars := []rune(text)
+   loss := 0.0
+   count := 0
+   for start := 0; start + 1 < len(chars); start += seq_len {
+      end := start + seq_len
+      if end > len(chars) - 1 {
+         end = len(chars) - 1
+      }
+      inputs := make([]*SimpleMatrix, 0, end - start)
+      expects := make([]*SimpleMatrix, 0, end - start)
+      for i := start; i < end; i++ {
+         inputs = append(inputs, c.Encode(chars[i]))
+         expects = append(expects, c.Encode(chars[i + 1]))
+      }
+      c.Chain.PredictRestart()
+      outputs := c.Train(inputs, expects, alpha)
+      for i, output := range outputs {
+         loss -= math.Log(__entropy_clip__(output.Data[0][c.index[chars[start + i + 1]]]))
+         count ++
+      }
+   }
+   if count == 0 {
+      return 0
+   }
+   return loss / float64(count)
+}
+
+// Generate length characters after seed; lower temperature gives more
+// conservative samples, temperature 1 samples the model distribution.
+func (c *CharRecurrentModel) Sample (seed string, length int, temperature float64) string {
+   inference := c.Chain.Layers[0].(*LayerRecordShadow).Inference()
+   c.Chain.SetInference(true)
+   c.Chain.PredictRestart()
+   prefix := []rune(seed)
+   if len(prefix) == 0 {
+      prefix = c.Chars[:1]
+   }
+   var output *SimpleMatrix
+   for _, ch := range prefix {
+      output = c.Chain.Predict(c.Encode(ch))
+   }
+   r := make([]rune, 0, length)
+   for i := 0; i < length; i++ {
+      ch := c.Chars[__char_model_pick__(__rand_or_default__(c.Chain.Rand), output.Row(0), temperature)]
+      r = append(r, ch)
+      output = c.Chain.Predict(c.Encode(ch))
+   }
+   c.Chain.SetInference(inference)
+   return string(r)
+}
+
+func __char_model_pick__ (random *Rand, p *SimpleMatrix, temperature float64) int {
+   if temperature <= 0 {
+      temperature = epsilon
+   }
+   // softmax(log(p) / T) without going back to the logits
+   w := p.Map(__entropy_clip__).Map(math.Log).Scale(1 / temperature).Softmax()
+   x := random.Float64()
+   for i, v := range w.Data[0] {
+      x -= v
+      if x < 0 {
+         return i
+      }
+   }
+   return w.N - 1
+}
@@ -0,0 +1,22 @@
+package neuralnetwork
+
+import (
+   "fmt"
+   "strings"
+   "testing"
+)
+
+func TestCharRecurrentModelSample (t *testing.T) {
+   corpus := strings.Repeat("aab", 20)
+   m := NewCharRecurrentModel(corpus, 12, 0.5)
+   m.Chain.Seed(1)
+   loss := 0.0
+   for i := 0; i < 300; i++ {
+      loss = m.TrainText(corpus, 12, 0.1)
+   }
+   sample := m.Sample("aab", 12, 0.1)
+   fmt.Println(loss, sample)
+   if sample != "aabaabaabaab" {
+      t.Fail()
+   }
+}
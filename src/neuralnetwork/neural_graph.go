@@ -0,0 +1,444 @@
+package neuralnetwork
+
+import (
+   "fmt"
+   "math"
+)
+
+// One node of a NeuralGraph: an input, a Layer fed by one node, or a merge of
+// several nodes ("add", "concat_right", "concat_bottom", "multiply").
+type GraphNode struct {
+   Id int
+   Layer Layer
+   Merge string
+   Inputs []int
+   M, N int
+   output *SimpleMatrix
+   values []*SimpleMatrix
+   grad *SimpleMatrix
+}
+
+func (g *GraphNode) IsInput () bool {
+   return g.Layer == nil && g.Merge == ""
+}
+
+// Directed acyclic network: nodes may only consume nodes added before them, so
+// the order of Nodes is a topological order. Forward runs in that order;
+// backward runs in reverse and sums the gradients of nodes with fan-out.
+//
+// Every output carries a loss weight: Learn starts from
+// weight * (expect - predict) on each output. A Layer instance must appear in
+// one node only.
+type NeuralGraph struct {
+   LayerBase
+   Nodes []*GraphNode
+   InputIds, OutputIds []int
+   LossWeights []float64
+   Rand *Rand
+}
+
+func NewNeuralGraph () *NeuralGraph {
+   g := new(NeuralGraph)
+   g.Nodes = make([]*GraphNode, 0)
+   g.InputIds = make([]int, 0)
+   g.OutputIds = make([]int, 0)
+   g.LossWeights = make([]float64, 0)
+   return g
+}
+
+func (g *NeuralGraph) addNode (node *GraphNode) int {
+   node.Id = len(g.Nodes)
+   g.Nodes = append(g.Nodes, node)
+   return node.Id
+}
+
+func (g *NeuralGraph) AddInput (m, n int) int {
+   id := g.addNode(&GraphNode{M: m, N: n})
+   g.InputIds = append(g.InputIds, id)
+   return id
+}
+
+func (g *NeuralGraph) AddNode (layer Layer, input int) (int, error) {
+   if input < 0 || input >= len(g.Nodes) {
+      return -1, fmt.Errorf("neuralnetwork: graph node %d does not exist", input)
+   }
+   // 0 stands for a dim the layer does not define, e.g. a chain without
+   // DefineInputDim
+   m, n := layer.InputDim()
+   if node := g.Nodes[input]; (m > 0 && m != node.M) || (n > 0 && n != node.N) {
+      return -1, fmt.Errorf("neuralnetwork: graph node %d of %dx%d feeds %T of %dx%d", input, node.M, node.N, layer, m, n)
+   }
+   m, n = layer.OutputDim()
+   return g.addNode(&GraphNode{Layer: layer, Inputs: []int{input}, M: m, N: n}), nil
+}
+
+func (g *NeuralGraph) AddMerge (merge string, inputs ...int) (int, error) {
+   if len(inputs) == 0 {
+      return -1, fmt.Errorf("neuralnetwork: graph merge %q without input", merge)
+   }
+   for _, id := range inputs {
+      if id < 0 || id >= len(g.Nodes) {
+         return -1, fmt.Errorf("neuralnetwork: graph node %d does not exist", id)
+      }
+   }
+   first := g.Nodes[inputs[0]]
+   m, n := first.M, first.N
+   for _, id := range inputs[1:] {
+      node := g.Nodes[id]
+      switch merge {
+      case "add", "multiply":
+         if node.M != m || node.N != n {
+            return -1, fmt.Errorf("neuralnetwork: graph %s of %dx%d and %dx%d", merge, m, n, node.M, node.N)
+         }
+      case "concat_right":
+         if node.M != m {
+            return -1, fmt.Errorf("neuralnetwork: graph concat_right of %d and %d rows", m, node.M)
+         }
+         n += node.N
+      case "concat_bottom":
+         if node.N != n {
+            return -1, fmt.Errorf("neuralnetwork: graph concat_bottom of %d and %d columns", n, node.N)
+         }
+         m += node.M
+      default:
+         return -1, fmt.Errorf("neuralnetwork: unknown graph merge %q", merge)
+      }
+   }
+   ids := make([]int, len(inputs))
+   copy(ids, inputs)
+   return g.addNode(&GraphNode{Merge: merge, Inputs: ids, M: m, N: n}), nil
+}
+
+func (g *NeuralGraph) AddOutput (id int, loss_weight float64) *NeuralGraph {
+   g.OutputIds = append(g.OutputIds, id)
+   g.LossWeights = append(g.LossWeights, loss_weight)
+   return g
+}
+
+// Sequential convenience like NeuralChain.AddLayer: the layer consumes the
+// latest node (an input of the layer's InputDim is created for an empty
+// graph) and becomes the only output. An error of AddNode is returned and the
+// graph left unchanged.
+func (g *NeuralGraph) TryAddLayer (layer Layer) (*NeuralGraph, error) {
+   if len(g.Nodes) == 0 {
+      g.AddInput(layer.InputDim())
+   }
+   id, err := g.AddNode(layer, len(g.Nodes) - 1)
+   if err != nil {
+      return g, err
+   }
+   g.OutputIds = []int{id}
+   g.LossWeights = []float64{1}
+   return g, nil
+}
+
+// TryAddLayer for the NeuralNetwork interface; panics on a layer that does
+// not fit the latest node, like MustLayerActivation.
+func (g *NeuralGraph) AddLayer (layer Layer) NeuralNetwork {
+   if _, err := g.TryAddLayer(layer); err != nil {
+      panic(err)
+   }
+   return g
+}
+
+func __graph_merge__ (merge string, values []*SimpleMatrix) *SimpleMatrix {
+   R := values[0].Clone()
+   for _, X := range values[1:] {
+      switch merge {
+      case "add":
+         R = R.Add(X, 1, 1)
+      case "multiply":
+         R = R.EltMul(X)
+      case "concat_right":
+         R = R.ConnectRight(X)
+      case "concat_bottom":
+         R = R.ConnectBottom(X)
+      }
+   }
+   return R
+}
+
+// Split the output gradient of a merge node into the gradients of its inputs.
+func __graph_merge_grad__ (merge string, values []*SimpleMatrix, grad *SimpleMatrix) []*SimpleMatrix {
+   r := make([]*SimpleMatrix, len(values))
+   offset := 0
+   for i, X := range values {
+      switch merge {
+      case "add":
+         r[i] = grad.Clone()
+      case "multiply":
+         r[i] = grad.Clone()
+         for k, Y := range values {
+            if k != i {
+               r[i] = r[i].EltMul(Y)
+            }
+         }
+      case "concat_right":
+         r[i] = grad.Window(0, offset, X.M, X.N)
+         offset += X.N
+      case "concat_bottom":
+         r[i] = grad.Window(offset, 0, X.M, X.N)
+         offset += X.M
+      }
+   }
+   return r
+}
+
+func (g *NeuralGraph) PredictMulti (inputs []*SimpleMatrix) []*SimpleMatrix {
+   for i, id := range g.InputIds {
+      g.Nodes[id].output = inputs[i]
+   }
+   for _, node := range g.Nodes {
+      if node.IsInput() {
+         continue
+      }
+      node.values = make([]*SimpleMatrix, len(node.Inputs))
+      for i, id := range node.Inputs {
+         node.values[i] = g.Nodes[id].output
+      }
+      if node.Layer != nil {
+         node.output = node.Layer.ForwardProp(node.values[0])
+      } else {
+         node.output = __graph_merge__(node.Merge, node.values)
+      }
+   }
+   r := make([]*SimpleMatrix, len(g.OutputIds))
+   for i, id := range g.OutputIds {
+      r[i] = g.Nodes[id].output.Clone()
+   }
+   return r
+}
+
+func (g *NeuralGraph) Predict (input *SimpleMatrix) *SimpleMatrix {
+   return g.PredictMulti([]*SimpleMatrix{input})[0]
+}
+
+// Stateless counterpart of PredictMulti, see NeuralChain.PredictSafe.
+func (g *NeuralGraph) PredictSafeMulti (inputs []*SimpleMatrix) []*SimpleMatrix {
+   return g.inferMulti(NewInferContext(), inputs)
+}
+
+func (g *NeuralGraph) PredictSafe (input *SimpleMatrix) *SimpleMatrix {
+   return g.PredictSafeMulti([]*SimpleMatrix{input})[0]
+}
+
+func (g *NeuralGraph) Infer (ctx *InferContext, input *SimpleMatrix) *SimpleMatrix {
+   return g.inferMulti(ctx, []*SimpleMatrix{input})[0]
+}
+
+func (g *NeuralGraph) inferMulti (ctx *InferContext, inputs []*SimpleMatrix) []*SimpleMatrix {
+   outputs := make([]*SimpleMatrix, len(g.Nodes))
+   for i, id := range g.InputIds {
+      outputs[id] = inputs[i]
+   }
+   for _, node := range g.Nodes {
+      if node.IsInput() {
+         continue
+      }
+      values := make([]*SimpleMatrix, len(node.Inputs))
+      for i, id := range node.Inputs {
+         values[i] = outputs[id]
+      }
+      if node.Layer != nil {
+         outputs[node.Id] = InferLayerOf(ctx, node.Layer, values[0])
+      } else {
+         outputs[node.Id] = __graph_merge__(node.Merge, values)
+      }
+   }
+   r := make([]*SimpleMatrix, len(g.OutputIds))
+   for i, id := range g.OutputIds {
+      r[i] = outputs[id]
+   }
+   return r
+}
+
+func (g *NeuralGraph) LearnMulti (predicts, expects []*SimpleMatrix) *NeuralGraph {
+   grads := make([]*SimpleMatrix, len(g.OutputIds))
+   for i := range g.OutputIds {
+      grads[i] = expects[i].Add(predicts[i], g.LossWeights[i], -g.LossWeights[i])
+   }
+   g.backward(grads)
+   return g
+}
+
+func (g *NeuralGraph) Learn (predict *SimpleMatrix, expect *SimpleMatrix) NeuralNetwork {
+   return g.LearnMulti([]*SimpleMatrix{predict}, []*SimpleMatrix{expect})
+}
+
+func (g *NeuralGraph) FitMulti (inputs, expects []*SimpleMatrix, alpha float64) *NeuralGraph {
+   g.LearnMulti(g.PredictMulti(inputs), expects).Update(alpha)
+   return g
+}
+
+func (g *NeuralGraph) Fit (input, expect *SimpleMatrix, alpha float64) NeuralNetwork {
+   return g.FitMulti([]*SimpleMatrix{input}, []*SimpleMatrix{expect}, alpha)
+}
+
+// Backward from the given gradients of the outputs; nodes that no output
+// depends on are left with a nil gradient.
+func (g *NeuralGraph) backward (output_grads []*SimpleMatrix) {
+   for _, node := range g.Nodes {
+      node.grad = nil
+   }
+   for i, id := range g.OutputIds {
+      g.accumulateGrad(id, output_grads[i])
+   }
+   for k := len(g.Nodes) - 1; k >= 0; k-- {
+      node := g.Nodes[k]
+      if node.grad == nil || node.IsInput() {
+         continue
+      }
+      if node.Layer != nil {
+         g.accumulateGrad(node.Inputs[0], node.Layer.BackwardProp(node.grad))
+         continue
+      }
+      for i, grad := range __graph_merge_grad__(node.Merge, node.values, node.grad) {
+         g.accumulateGrad(node.Inputs[i], grad)
+      }
+   }
+}
+
+func (g *NeuralGraph) accumulateGrad (id int, grad *SimpleMatrix) {
+   node := g.Nodes[id]
+   if node.grad == nil {
+      node.grad = grad.Clone()
+   } else {
+      node.grad = node.grad.Add(grad, 1, 1)
+   }
+}
+
+// Gradient of the i-th input after the latest Learn.
+func (g *NeuralGraph) InputGrad (i int) *SimpleMatrix {
+   node := g.Nodes[g.InputIds[i]]
+   if node.grad == nil {
+      return NewSimpleMatrix(node.M, node.N)
+   }
+   return node.grad.Clone()
+}
+
+// Only layers reached by the latest backward pass are updated.
+func (g *NeuralGraph) Update (alpha float64) NeuralNetwork {
+   for k := len(g.Nodes) - 1; k >= 0; k-- {
+      node := g.Nodes[k]
+      if node.Layer != nil && node.grad != nil {
+         node.Layer.ParamsUpdate(alpha)
+      }
+   }
+   return g
+}
+
+func (g *NeuralGraph) Error (predict, expect *SimpleMatrix) float64 {
+   return expect.Add(predict, 1, -1).Map(math.Abs).EltSum() / float64(predict.M * predict.N)
+}
+
+func (g *NeuralGraph) Seed (seed int64) *NeuralGraph {
+   g.Reseed(NewRand(seed))
+   return g
+}
+
+func (g *NeuralGraph) Reseed (r *Rand) {
+   g.Rand = r
+   for _, node := range g.Nodes {
+      if l, ok := node.Layer.(RandomLayer); ok {
+         l.Reseed(r)
+      }
+   }
+}
+
+func (g *NeuralGraph) SetTraining (training bool) {
+   for _, node := range g.Nodes {
+      if l, ok := node.Layer.(ModeLayer); ok {
+         l.SetTraining(training)
+      }
+   }
+}
+
+// As a Layer, the graph has one input and its first output.
+
+func (g *NeuralGraph) OutputDim () (int, int) {
+   if len(g.OutputIds) == 0 {
+      return 0, 0
+   }
+   node := g.Nodes[g.OutputIds[0]]
+   return node.M, node.N
+}
+
+func (g *NeuralGraph) InputDim () (int, int) {
+   if len(g.InputIds) == 0 {
+      return 0, 0
+   }
+   node := g.Nodes[g.InputIds[0]]
+   return node.M, node.N
+}
+
+func (g *NeuralGraph) ForwardProp (input *SimpleMatrix) *SimpleMatrix {
+   g.lastInput = input.Clone()
+   g.lastOutput = g.Predict(g.lastInput)
+   return g.lastOutput.Clone()
+}
+
+func (g *NeuralGraph) BackwardProp (output_grad *SimpleMatrix) *SimpleMatrix {
+   grads := make([]*SimpleMatrix, len(g.OutputIds))
+   for i, id := range g.OutputIds {
+      node := g.Nodes[id]
+      grads[i] = NewSimpleMatrix(node.M, node.N)
+   }
+   grads[0] = output_grad
+   g.backward(grads)
+   g.lastGrad = g.InputGrad(0)
+   return g.lastGrad.Clone()
+}
+
+// Parameters of all layer nodes, named "node<id>.<name>", aligned with Delta().
+func (g *NeuralGraph) Params () []NamedMatrix {
+   r := make([]NamedMatrix, 0)
+   for _, node := range g.Nodes {
+      if node.Layer != nil {
+         r = append(r, __prefix_named__(fmt.Sprintf("node%d", node.Id), ParamsOf(node.Layer)) ...)
+      }
+   }
+   return r
+}
+
+func (g *NeuralGraph) Grads () []NamedMatrix {
+   r := make([]NamedMatrix, 0)
+   for _, node := range g.Nodes {
+      if node.Layer != nil {
+         r = append(r, __prefix_named__(fmt.Sprintf("node%d", node.Id), GradsOf(node.Layer)) ...)
+      }
+   }
+   return r
+}
+
+func (g *NeuralGraph) DeltaN () int {
+   n := 0
+   for _, node := range g.Nodes {
+      if node.Layer != nil {
+         n += node.Layer.DeltaN()
+      }
+   }
+   return n
+}
+
+func (g *NeuralGraph) Delta () []*SimpleMatrix {
+   r := make([]*SimpleMatrix, 0)
+   for _, node := range g.Nodes {
+      if node.Layer != nil {
+         r = append(r, node.Layer.Delta() ...)
+      }
+   }
+   return r
+}
+
+func (g *NeuralGraph) CorrectDelta (delta []*SimpleMatrix, offset int) {
+   for _, node := range g.Nodes {
+      if node.Layer != nil {
+         node.Layer.CorrectDelta(delta, offset)
+         offset += node.Layer.DeltaN()
+      }
+   }
+}
+
+func (g *NeuralGraph) ParamsUpdate (alpha float64) {
+   g.Update(alpha)
+}
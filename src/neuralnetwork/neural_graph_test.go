@@ -0,0 +1,113 @@
+package neuralnetwork
+
+import (
+   "fmt"
+   "math"
+   "testing"
+)
+
+var _ NeuralNetwork = (*NeuralGraph)(nil)
+
+// x1 -> linear -> tanh = a, x2 -> linear = b, s = a + b, p = a * s,
+// out1 = linear(s | p), out2 = linear(s); a and s fan out.
+func buildTestGraph () (*NeuralGraph, []*LayerLinear) {
+   g := NewNeuralGraph()
+   linears := []*LayerLinear{
+      NewLayerLinear(1, 3, 4, 0, false),
+      NewLayerLinear(1, 2, 4, 0, false),
+      NewLayerLinear(1, 8, 2, 0, false),
+      NewLayerLinear(1, 4, 1, 0, false),
+   }
+   x1 := g.AddInput(1, 3)
+   x2 := g.AddInput(1, 2)
+   a, _ := g.AddNode(linears[0], x1)
+   a, _ = g.AddNode(MustLayerActivation(1, 4, "tanh"), a)
+   b, _ := g.AddNode(linears[1], x2)
+   s, _ := g.AddMerge("add", a, b)
+   p, _ := g.AddMerge("multiply", a, s)
+   c, _ := g.AddMerge("concat_right", s, p)
+   out1, _ := g.AddNode(linears[2], c)
+   out2, _ := g.AddNode(linears[3], s)
+   g.AddOutput(out1, 1).AddOutput(out2, 0.5)
+   g.Seed(11)
+   return g, linears
+}
+
+func testGraphLoss (g *NeuralGraph, inputs, expects []*SimpleMatrix) float64 {
+   loss := 0.0
+   for i, predict := range g.PredictMulti(inputs) {
+      d := expects[i].Add(predict, 1, -1)
+      loss += g.LossWeights[i] * 0.5 * d.EltMul(d).EltSum()
+   }
+   return loss
+}
+
+func TestNeuralGraphGradient (t *testing.T) {
+   g, linears := buildTestGraph()
+   inputs := []*SimpleMatrix{
+      NewSimpleMatrix(1, 3).FillElt([]float64{0.5, -0.3, 0.8}),
+      NewSimpleMatrix(1, 2).FillElt([]float64{-0.7, 0.2}),
+   }
+   expects := []*SimpleMatrix{
+      NewSimpleMatrix(1, 2).FillElt([]float64{0.1, -0.4}),
+      NewSimpleMatrix(1, 1).FillElt([]float64{0.6}),
+   }
+   g.LearnMulti(g.PredictMulti(inputs), expects)
+   loss := func () float64 {
+      return testGraphLoss(g, inputs, expects)
+   }
+   for k, layer := range linears {
+      checkTestDelta(t, fmt.Sprintf("linear %d W", k), layer.W, layer.Delta()[0], loss)
+   }
+}
+
+func TestNeuralGraphMergeDim (t *testing.T) {
+   g := NewNeuralGraph()
+   x1 := g.AddInput(1, 3)
+   x2 := g.AddInput(2, 3)
+   if _, err := g.AddMerge("add", x1, x2); err == nil {
+      t.Fail()
+   }
+   if _, err := g.AddMerge("concat_right", x1, x2); err == nil {
+      t.Fail()
+   }
+   id, err := g.AddMerge("concat_bottom", x1, x2)
+   if err != nil || g.Nodes[id].M != 3 || g.Nodes[id].N != 3 {
+      t.Fail()
+   }
+   if _, err := g.AddMerge("max", x1, x2); err == nil {
+      t.Fail()
+   }
+}
+
+func TestNeuralGraphAsChain (t *testing.T) {
+   chain := buildTestXorChain(42)
+   chain.Layers = append(chain.Layers[:2], chain.Layers[3:] ...)
+   g := NewNeuralGraph()
+   for _, layer := range chain.Layers {
+      replica, _ := ReplicaOf(layer)
+      if _, err := g.TryAddLayer(replica); err != nil {
+         t.Fatal(err)
+      }
+   }
+   if _, err := g.TryAddLayer(NewLayerLinear(1, 3, 1, 0, false)); err == nil || len(g.Nodes) != len(chain.Layers) + 1 {
+      t.Error("layer of mismatching input dims added")
+   }
+   func () {
+      defer func () {
+         if recover() == nil {
+            t.Error("AddLayer accepted a layer of mismatching input dims")
+         }
+      }()
+      g.AddLayer(NewLayerLinear(1, 3, 1, 0, false))
+   }()
+   input := NewSimpleMatrix(1, 2).FillElt([]float64{1, 0})
+   expect := NewSimpleMatrix(1, 1).FillElt([]float64{1})
+   for i := 0; i < 10; i++ {
+      chain.Fit(input, expect, 0.2)
+      g.Fit(input, expect, 0.2)
+   }
+   if math.Abs(chain.Predict(input).Data[0][0] - g.PredictSafe(input).Data[0][0]) > 1e-12 {
+      t.Fail()
+   }
+}
@@ -0,0 +1,74 @@
+package neuralnetwork
+
+import "sync"
+
+// Data-parallel mini-batch training: the chain is replicated, every replica
+// runs forward/backward on its own shard of the batch in a goroutine, and the
+// summed deltas are applied to all replicas through CorrectDelta, which keeps
+// them identical. The result equals NeuralChain.FitBatch up to floating-point
+// reassociation (layers with running state, e.g. LayerBatchNorm statistics,
+// only see the shard of their replica).
+type ParallelTrainer struct {
+   Chain *NeuralChain
+   // Replicas[0] is Chain itself
+   Replicas []*NeuralChain
+}
+
+func NewParallelTrainer (chain *NeuralChain, n int) (*ParallelTrainer, error) {
+   p := new(ParallelTrainer)
+   p.Chain = chain
+   p.Replicas = []*NeuralChain{chain}
+   for i := 1; i < n; i++ {
+      replica, err := chain.Replica()
+      if err != nil {
+         return nil, err
+      }
+      p.Replicas = append(p.Replicas, replica.(*NeuralChain))
+   }
+   return p, nil
+}
+
+func (p *ParallelTrainer) Fit (inputs, expects []*SimpleMatrix, alpha float64) *ParallelTrainer {
+   n := len(p.Replicas)
+   size := (len(inputs) + n - 1) / n
+   sums := make([][]*SimpleMatrix, n)
+   var wg sync.WaitGroup
+   for r, replica := range p.Replicas {
+      lo := r * size
+      hi := lo + size
+      if hi > len(inputs) {
+         hi = len(inputs)
+      }
+      if lo >= hi {
+         continue
+      }
+      wg.Add(1)
+      go func (r int, replica *NeuralChain, lo, hi int) {
+         defer wg.Done()
+         sums[r] = replica.accumulateDelta(inputs[lo:hi], expects[lo:hi])
+      }(r, replica, lo, hi)
+   }
+   wg.Wait()
+
+   var total []*SimpleMatrix
+   for _, sum := range sums {
+      if sum == nil {
+         continue
+      }
+      if total == nil {
+         total = sum
+         continue
+      }
+      for k, d := range sum {
+         total[k] = total[k].Add(d, 1, 1)
+      }
+   }
+   for _, replica := range p.Replicas {
+      if total != nil {
+         // every replica may consume (e.g. clear) the delta it is given
+         replica.CorrectDelta(__clone_all__(total), 0)
+      }
+      replica.Update(alpha)
+   }
+   return p
+}
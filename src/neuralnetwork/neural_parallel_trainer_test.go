@@ -0,0 +1,59 @@
+package neuralnetwork
+
+import (
+   "math"
+   "testing"
+)
+
+func TestParallelTrainerMatchesFitBatch (t *testing.T) {
+   chain := NewNeuralChain()
+   chain.AddLayer(NewLayerLinear(1, 3, 8, 0, false))
+   chain.AddLayer(MustLayerActivation(1, 8, "tanh"))
+   chain.AddLayer(NewLayerLinear(1, 8, 2, 0, false))
+   chain.AddLayer(MustLayerActivation(1, 2, "sigmoid"))
+   chain.Seed(3)
+
+   layer, err := chain.Replica()
+   if err != nil {
+      t.Fatal(err)
+   }
+   serial := layer.(*NeuralChain)
+   trainer, err := NewParallelTrainer(chain, 4)
+   if err != nil {
+      t.Fatal(err)
+   }
+
+   random := NewRand(5)
+   for epoch := 0; epoch < 20; epoch++ {
+      inputs := make([]*SimpleMatrix, 10)
+      expects := make([]*SimpleMatrix, 10)
+      for i := range inputs {
+         inputs[i] = random.FillRandom(NewSimpleMatrix(1, 3), -1, 1)
+         expects[i] = random.FillRandom(NewSimpleMatrix(1, 2), 0, 1)
+      }
+      serial.FitBatch(inputs, expects, 0.1)
+      trainer.Fit(inputs, expects, 0.1)
+   }
+
+   for _, replica := range trainer.Replicas {
+      for _, i := range []int{0, 2} {
+         a := serial.Layers[i].(*LayerLinear).W
+         b := replica.Layers[i].(*LayerLinear).W
+         for r := range a.Data {
+            for c := range a.Data[r] {
+               if math.Abs(a.Data[r][c] - b.Data[r][c]) > 1e-9 {
+                  t.Fatalf("layer %d W[%d][%d]: %v != %v", i, r, c, a.Data[r][c], b.Data[r][c])
+               }
+            }
+         }
+      }
+   }
+}
+
+func TestParallelTrainerRejectsRecurrentLayer (t *testing.T) {
+   chain := NewNeuralChain()
+   chain.AddLayer(NewLayerRecordShadow(NewLayerLinear(1, 2, 2, 0, false), 1, 2, new(NopActionOfLayerRecordShadow)))
+   if _, err := NewParallelTrainer(chain, 2); err == nil {
+      t.Fail()
+   }
+}
@@ -1,5 +1,7 @@
 package neuralnetwork
 
+import "fmt"
+
 type NeuralRecurrentChain struct {
    NeuralChain
 }
@@ -13,12 +15,66 @@ func NewNeuralRecurrentChain (input_m, input_n int) *NeuralRecurrentChain {
 
 func (n *NeuralRecurrentChain) PredictRestart () {
    for _, layer := range n.Layers {
-      lrs := layer.(*LayerRecordShadow)
-      lrs.action.ResetRecord(lrs)
+      if record, ok := layer.(*LayerRecordShadow); ok {
+         record.Restart()
+      }
+   }
+}
+
+// Switch all recurrent layers into (or out of) inference mode; see
+// LayerRecordShadow.SetInference. Leaving inference mode restarts the chain.
+func (n *NeuralRecurrentChain) SetInference (inference bool) *NeuralRecurrentChain {
+   for _, layer := range n.Layers {
+      if record, ok := layer.(*LayerRecordShadow); ok {
+         record.SetInference(inference)
+      }
    }
+   return n
+}
+
+// Snapshot the latest record (e.g. hidden state) of every layer, so that one
+// trained chain can serve many sessions via LoadState; nil for a layer that
+// is not recurrent.
+func (n *NeuralRecurrentChain) SaveState () []*SimpleMatrix {
+   state := make([]*SimpleMatrix, len(n.Layers))
+   for i, layer := range n.Layers {
+      if record, ok := layer.(*LayerRecordShadow); ok {
+         state[i] = record.SaveRecord()
+      }
+   }
+   return state
+}
+
+// Load a state of SaveState; a state of another chain is an error and leaves
+// the chain unchanged.
+func (n *NeuralRecurrentChain) LoadState (state []*SimpleMatrix) error {
+   if len(state) != len(n.Layers) {
+      return fmt.Errorf("neuralnetwork: state of %d layers for a chain of %d", len(state), len(n.Layers))
+   }
+   for i, layer := range n.Layers {
+      record, ok := layer.(*LayerRecordShadow)
+      switch {
+      case !ok && state[i] != nil:
+         return fmt.Errorf("neuralnetwork: state for layer %d, which is not recurrent", i)
+      case ok && state[i] == nil:
+         return fmt.Errorf("neuralnetwork: no state for recurrent layer %d", i)
+      case ok && (state[i].M != record.recordM || state[i].N != record.recordN):
+         return fmt.Errorf("neuralnetwork: state of %dx%d for layer %d of %dx%d", state[i].M, state[i].N, i, record.recordM, record.recordN)
+      }
+   }
+   for i, layer := range n.Layers {
+      if record, ok := layer.(*LayerRecordShadow); ok {
+         record.LoadRecord(state[i])
+      }
+   }
+   return nil
 }
 
 func (n *NeuralRecurrentChain) AddLayer (layer Layer) NeuralNetwork {
+   if _, ok := layer.(*LayerEmbedding); ok {
+      // embedding accumulates its sparse delta by itself across time steps
+      return n.AddRecurrentLayer(layer, "input_record")
+   }
    return n.AddRecurrentLayer(layer, "input_record_delay_update")
 }
 
@@ -0,0 +1,129 @@
+package neuralnetwork
+
+import (
+   "math"
+   "testing"
+)
+
+func testRecurrentInputs (n, size int) []*SimpleMatrix {
+   random := NewRand(9)
+   r := make([]*SimpleMatrix, n)
+   for i := range r {
+      r[i] = random.FillRandom(NewSimpleMatrix(1, size), -1, 1)
+   }
+   return r
+}
+
+// Inference mode gives the outputs of training mode while keeping one
+// record per layer, however long the sequence.
+func TestRecurrentChainInferenceMemory (t *testing.T) {
+   model := NewRecurrentModel(3, 4, 3, 1.0, "tanh", "softmax")
+   model.Chain.Seed(1)
+   inputs := testRecurrentInputs(1000, 3)
+   expect := make([]*SimpleMatrix, 5)
+   for i := range expect {
+      expect[i] = model.Chain.Predict(inputs[i])
+   }
+
+   model.Chain.SetInference(true)
+   model.Chain.PredictRestart()
+   for i, input := range inputs {
+      output := model.Chain.Predict(input)
+      if i < len(expect) && output.Add(expect[i], 1, -1).Map(math.Abs).EltMax() > 1e-12 {
+         t.Fatalf("step %d: inference differs from training", i)
+      }
+   }
+   for i, layer := range model.Chain.Layers {
+      record := layer.(*LayerRecordShadow)
+      if len(record.cache) != 1 || len(record.extra) != 1 || len(record.snapshots) != 1 {
+         t.Errorf("layer %d keeps %d records", i, len(record.cache))
+      }
+   }
+}
+
+// A saved state resumes the sequence where it was saved, also in another
+// session of the chain.
+func TestRecurrentChainSaveLoadState (t *testing.T) {
+   model := NewRecurrentModel(3, 4, 3, 1.0, "tanh", "softmax")
+   model.Chain.Seed(2)
+   model.Chain.SetInference(true)
+   inputs := testRecurrentInputs(10, 3)
+   for _, input := range inputs[:5] {
+      model.Chain.Predict(input)
+   }
+   state := model.Chain.SaveState()
+   expect := make([]*SimpleMatrix, 0)
+   for _, input := range inputs[5:] {
+      expect = append(expect, model.Chain.Predict(input))
+   }
+
+   for _, input := range inputs {
+      // another session moves the state on
+      model.Chain.Predict(input)
+   }
+   if err := model.Chain.LoadState(state); err != nil {
+      t.Fatal(err)
+   }
+   for i, input := range inputs[5:] {
+      if model.Chain.Predict(input).Add(expect[i], 1, -1).Map(math.Abs).EltMax() > 1e-12 {
+         t.Fatalf("step %d differs after LoadState", i + 5)
+      }
+   }
+   model.Chain.PredictRestart()
+   if model.Chain.Predict(inputs[5]).Add(expect[0], 1, -1).Map(math.Abs).EltMax() == 0 {
+      t.Error("restart keeps the state")
+   }
+
+   // states of another chain are rejected and change nothing
+   saved := model.Chain.SaveState()
+   other := NewRecurrentModel(3, 5, 3, 1.0, "tanh", "softmax").Chain.SaveState()
+   wrong := [][]*SimpleMatrix{state[1:], append(state, nil), other, make([]*SimpleMatrix, len(state))}
+   for k, s := range wrong {
+      if err := model.Chain.LoadState(s); err == nil {
+         t.Errorf("state %d loaded", k)
+      }
+   }
+   plain := NewNeuralRecurrentChain(1, 3)
+   plain.Layers = append(plain.Layers, MustLayerActivation(1, 3, "tanh"))
+   if err := plain.LoadState([]*SimpleMatrix{NewSimpleMatrix(1, 3)}); err == nil {
+      t.Error("state loaded into a layer that is not recurrent")
+   }
+   if err := plain.LoadState(plain.SaveState()); err != nil {
+      t.Error(err)
+   }
+   for i, s := range model.Chain.SaveState() {
+      if s.Add(saved[i], 1, -1).Map(math.Abs).EltMax() != 0 {
+         t.Fatalf("layer %d changed by a rejected state", i)
+      }
+   }
+}
+
+// Every InferContext carries a sequence of its own: interleaved sessions
+// give the outputs of Predict and leave the records of the chain alone.
+func TestRecurrentChainInferSessions (t *testing.T) {
+   model := NewRecurrentModel(3, 4, 3, 1.0, "tanh", "softmax")
+   model.Chain.Seed(3)
+   inputs := [][]*SimpleMatrix{testRecurrentInputs(6, 3), testRecurrentInputs(12, 3)[6:]}
+   expect := make([][]*SimpleMatrix, len(inputs))
+   for s := range inputs {
+      model.Chain.PredictRestart()
+      for _, input := range inputs[s] {
+         expect[s] = append(expect[s], model.Chain.Predict(input))
+      }
+   }
+   model.Chain.PredictRestart()
+   model.Chain.Predict(inputs[0][0])
+   ctxs := []*InferContext{NewInferContext(), NewInferContext()}
+   for i := range inputs[0] {
+      for s, ctx := range ctxs {
+         if model.Chain.Infer(ctx, inputs[s][i]).Add(expect[s][i], 1, -1).Map(math.Abs).EltMax() > 1e-12 {
+            t.Fatalf("session %d step %d differs from Predict", s, i)
+         }
+      }
+   }
+   for i, layer := range model.Chain.Layers {
+      if record := layer.(*LayerRecordShadow); len(record.cache) != 2 || record.cursor != 1 {
+         t.Errorf("layer %d: Infer moved the records of the chain", i)
+      }
+   }
+}
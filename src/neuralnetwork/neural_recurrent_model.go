@@ -0,0 +1,64 @@
+package neuralnetwork
+
+// ref: https://iamtrask.github.io/2015/11/15/anyone-can-code-lstm
+
+// Simple recurrent model: linear -> recurrent activation -> linear -> output,
+// trained by back-propagation through time over a whole sequence.
+type RecurrentModel struct {
+   Chain *NeuralRecurrentChain
+   InputN, HiddenN, OutputN int
+}
+
+func NewRecurrentModel (
+   input_n, hidden_n, output_n int,
+   gain float64, hidden_fun, output_fun string,
+) *RecurrentModel {
+   // gain: of the Xavier initialization of the linear layers
+   // hidden_fun: any name of ActivationNames(); panics otherwise, as
+   //             MustLayerActivation
+   // output_fun: "softmax" or any name of ActivationNames()
+   hidden := MustLayerActivation(1, hidden_n, hidden_fun)
+   var output Layer
+   if output_fun == "softmax" {
+      output = NewLayerLogRegression(1, output_n)
+   } else {
+      output = MustLayerActivation(1, output_n, output_fun)
+   }
+   r := new(RecurrentModel)
+   r.InputN = input_n
+   r.HiddenN = hidden_n
+   r.OutputN = output_n
+   r.Chain = NewNeuralRecurrentChain(1, input_n)
+   r.Chain.AddLayer(NewLayerLinear(1, input_n, hidden_n, 0, true, NewXavierUniform(gain)))
+   r.Chain.AddRecurrentLayer(hidden, "basic_recurrence")
+   r.Chain.AddLayer(NewLayerLinear(1, hidden_n, output_n, 0, true, NewXavierUniform(gain)))
+   r.Chain.AddRecurrentLayer(output, "output_record")
+   return r
+}
+
+// Feed a sequence step by step and learn from the expected outputs in
+// reverse order; returns the predicted outputs of every step.
+func (r *RecurrentModel) Train (inputs, expects []*SimpleMatrix, alpha float64) []*SimpleMatrix {
+   outputs := make([]*SimpleMatrix, len(inputs))
+   for t, input := range inputs {
+      outputs[t] = r.Chain.Predict(input)
+   }
+   for t := len(inputs) - 1; t >= 0; t-- {
+      r.Chain.Learn(outputs[t], expects[t])
+   }
+   r.Chain.Update(alpha)
+   return outputs
+}
+
+// Predict a whole sequence from a fresh hidden state.
+func (r *RecurrentModel) Run (inputs []*SimpleMatrix) []*SimpleMatrix {
+   inference := r.Chain.Layers[0].(*LayerRecordShadow).Inference()
+   r.Chain.SetInference(true)
+   r.Chain.PredictRestart()
+   outputs := make([]*SimpleMatrix, len(inputs))
+   for t, input := range inputs {
+      outputs[t] = r.Chain.Predict(input)
+   }
+   r.Chain.SetInference(inference)
+   return outputs
+}
@@ -0,0 +1,97 @@
+package neuralnetwork
+
+import (
+   "fmt"
+   "math"
+)
+
+// Parameter or gradient matrix with a path-like name, e.g. "layer2.W".
+type NamedMatrix struct {
+   Name string
+   Value *SimpleMatrix
+}
+
+type ParamLayer interface {
+   // Parameter matrices aligned with Delta(): Delta()[i] updates Params()[i].
+   Params () []NamedMatrix
+}
+
+func __prefix_named__ (prefix string, list []NamedMatrix) []NamedMatrix {
+   r := make([]NamedMatrix, len(list))
+   for i, p := range list {
+      r[i] = NamedMatrix{Name: prefix + "." + p.Name, Value: p.Value}
+   }
+   return r
+}
+
+func __named__ (names []string, values []*SimpleMatrix) []NamedMatrix {
+   r := make([]NamedMatrix, len(values))
+   for i, v := range values {
+      r[i] = NamedMatrix{Name: names[i], Value: v}
+   }
+   return r
+}
+
+func ParamsOf (layer Layer) []NamedMatrix {
+   if l, ok := layer.(ParamLayer); ok {
+      return l.Params()
+   }
+   return make([]NamedMatrix, 0)
+}
+
+// Deltas of a layer named after its parameters. Deltas follow the chain
+// convention: they are negative gradients, applied as W += alpha * delta.
+func GradsOf (layer Layer) []NamedMatrix {
+   params := ParamsOf(layer)
+   delta := layer.Delta()
+   r := make([]NamedMatrix, len(delta))
+   for i, d := range delta {
+      name := fmt.Sprintf("delta%d", i)
+      if i < len(params) {
+         name = params[i].Name
+      }
+      r[i] = NamedMatrix{Name: name, Value: d}
+   }
+   return r
+}
+
+func ZeroGradOf (layer Layer) {
+   delta := layer.Delta()
+   zero := make([]*SimpleMatrix, len(delta))
+   for i, d := range delta {
+      zero[i] = NewSimpleMatrix(d.M, d.N)
+   }
+   layer.CorrectDelta(zero, 0)
+}
+
+// Scale all deltas of the layer so that their global L2 norm is at most
+// max_norm; returns the norm before clipping.
+func ClipGradNormOf (layer Layer, max_norm float64) float64 {
+   delta := layer.Delta()
+   sum := 0.0
+   for _, d := range delta {
+      sum += d.EltMul(d).EltSum()
+   }
+   norm := math.Sqrt(sum)
+   if norm <= max_norm {
+      return norm
+   }
+   clipped := make([]*SimpleMatrix, len(delta))
+   for i, d := range delta {
+      clipped[i] = d.Scale(max_norm / norm)
+   }
+   layer.CorrectDelta(clipped, 0)
+   return norm
+}
+
+// Clamp every delta element into [-limit, limit].
+func ClipGradValueOf (layer Layer, limit float64) {
+   delta := layer.Delta()
+   clipped := make([]*SimpleMatrix, len(delta))
+   for i, d := range delta {
+      clipped[i] = d.Map(func (x float64) float64 {
+         return math.Max(-limit, math.Min(limit, x))
+      })
+   }
+   layer.CorrectDelta(clipped, 0)
+}
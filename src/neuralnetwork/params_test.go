@@ -0,0 +1,166 @@
+package neuralnetwork
+
+import (
+   "math"
+   "testing"
+)
+
+func TestNeuralChainNestedDelta (t *testing.T) {
+   inner := NewNeuralChain()
+   inner.AddLayer(NewLayerLinear(1, 3, 3, 0, true))
+   inner.AddLayer(MustLayerActivation(1, 3, "prelu"))
+   n := NewNeuralChain()
+   n.AddLayer(NewLayerLinear(1, 2, 3, 0, false))
+   n.AddLayer(NewLayerShadow(inner))
+   n.Seed(1)
+
+   names := []string{"layer0.W", "layer0.b", "layer1.layer0.W", "layer1.layer0.b", "layer1.layer1.a"}
+   params := n.Params()
+   grads := n.Grads()
+   if len(params) != len(names) || len(grads) != len(names) || len(n.Delta()) != n.DeltaN() {
+      t.Fatalf("%d params, %d grads, %d deltas", len(params), len(grads), len(n.Delta()))
+   }
+   for i, name := range names {
+      if params[i].Name != name || grads[i].Name != name {
+         t.Errorf("%s: %s %s", name, params[i].Name, grads[i].Name)
+      }
+   }
+
+   input := NewSimpleMatrix(1, 2).FillElt([]float64{1, -2})
+   n.Learn(n.Predict(input), NewSimpleMatrix(1, 3).Fill(3))
+   if n.Grads()[2].Value != inner.Layers[0].Delta()[0] {
+      t.Error("nested delta not exposed")
+   }
+
+   norm := n.ClipGradNorm(0.5)
+   clipped := 0.0
+   for _, d := range n.Delta() {
+      clipped += d.EltMul(d).EltSum()
+   }
+   if norm <= 0.5 || math.Abs(math.Sqrt(clipped) - 0.5) > 1e-12 {
+      t.Errorf("norm %v clipped to %v", norm, math.Sqrt(clipped))
+   }
+   n.ClipGradValue(0.01)
+   for _, d := range n.Delta() {
+      if d.Map(math.Abs).EltMax() > 0.01 {
+         t.Error("value not clipped")
+      }
+   }
+   n.ZeroGrad()
+   for _, d := range n.Delta() {
+      if d.Map(math.Abs).EltMax() != 0 {
+         t.Error("gradient not zeroed")
+      }
+   }
+}
+
+// The delay-update action must apply the sum of the deltas of all steps,
+// once, and start from zero for the next sequence.
+func TestRecurrentChainDelayUpdateSum (t *testing.T) {
+   inner := NewNeuralChain()
+   inner.AddLayer(NewLayerLinear(1, 2, 2, 0, false))
+   n := NewNeuralRecurrentChain(1, 2)
+   n.AddLayer(inner)
+   n.Seed(2)
+   linear := inner.Layers[0].(*LayerLinear)
+
+   random := NewRand(3)
+   for round := 0; round < 2; round++ {
+      inputs := make([]*SimpleMatrix, 3)
+      expects := make([]*SimpleMatrix, 3)
+      predicts := make([]*SimpleMatrix, 3)
+      for i := range inputs {
+         inputs[i] = random.FillRandom(NewSimpleMatrix(1, 2), -1, 1)
+         expects[i] = random.FillRandom(NewSimpleMatrix(1, 2), -1, 1)
+         predicts[i] = n.Predict(inputs[i])
+      }
+      W := linear.W.Clone()
+      sum := NewSimpleMatrix(2, 2)
+      for i := len(inputs) - 1; i >= 0; i-- {
+         n.Learn(predicts[i], expects[i])
+         sum = sum.Add(inputs[i].T().Dot(expects[i].Add(predicts[i], 1, -1)), 1, 1)
+      }
+      grads := n.Grads()
+      if grads[0].Name != "layer0.layer0.W" || grads[0].Value.Add(sum, 1, -1).Map(math.Abs).EltMax() > 1e-12 {
+         t.Fatalf("round %d: accumulated %v, expected %v", round, grads[0].Value.Data, sum.Data)
+      }
+      n.Update(0.1)
+      if linear.W.Add(W.Add(sum, 1, 0.1), 1, -1).Map(math.Abs).EltMax() > 1e-12 {
+         t.Fatalf("round %d: update does not apply the sum", round)
+      }
+   }
+}
+
+// Back-propagating a step of a nested chain must use the caches of that step
+// rather than running it again: same dropout mask, batch statistics updated
+// once per forward step.
+func TestRecurrentChainRestoresStepCaches (t *testing.T) {
+   dropout := NewLayerDropout(2, 4, 0.5, 5)
+   norm := NewLayerBatchNorm(2, 4, 0.5)
+   inner := NewNeuralChain()
+   inner.AddLayer(NewLayerLinear(2, 3, 4, 0, true))
+   inner.AddLayer(norm)
+   inner.AddLayer(dropout)
+   n := NewNeuralRecurrentChain(2, 3)
+   n.AddLayer(inner)
+   n.Seed(4)
+
+   random := NewRand(6)
+   masks := make([]*SimpleMatrix, 3)
+   predicts := make([]*SimpleMatrix, 3)
+   for i := range predicts {
+      predicts[i] = n.Predict(random.FillRandom(NewSimpleMatrix(2, 3), -1, 1))
+      masks[i] = dropout.Mask().Clone()
+   }
+   mean := norm.RunningMean.Clone()
+   for i := len(predicts) - 1; i >= 0; i-- {
+      n.Learn(predicts[i], random.FillRandom(NewSimpleMatrix(2, 4), -1, 1))
+      if dropout.Mask().Add(masks[i], 1, -1).Map(math.Abs).EltMax() != 0 {
+         t.Fatalf("step %d: back-propagated with another mask", i)
+      }
+   }
+   if norm.RunningMean.Add(mean, 1, -1).Map(math.Abs).EltMax() != 0 {
+      t.Error("running statistics updated during back-propagation")
+   }
+}
+
+// The recurrent weight H is a parameter like any other: named, clipped and
+// zeroed with the weights of the shadow.
+func TestRecurrentChainClipsRecurrentWeight (t *testing.T) {
+   n := NewNeuralRecurrentChain(1, 3)
+   n.AddRecurrentLayer(NewLayerLinear(1, 3, 3, 0, false), "basic_recurrence")
+   n.Seed(7)
+   params := n.Params()
+   h := len(params) - 1
+   if params[h].Name != "layer0.H" || len(n.Delta()) != n.DeltaN() || len(n.Delta()) != len(params) {
+      t.Fatalf("%d params, %d deltas, DeltaN %d", len(params), len(n.Delta()), n.DeltaN())
+   }
+
+   random := NewRand(8)
+   predicts := make([]*SimpleMatrix, 3)
+   for i := range predicts {
+      predicts[i] = n.Predict(random.FillRandom(NewSimpleMatrix(1, 3), -1, 1))
+   }
+   for i := len(predicts) - 1; i >= 0; i-- {
+      n.Learn(predicts[i], NewSimpleMatrix(1, 3).Fill(5))
+   }
+   H := n.Grads()[h].Value
+   if H.Map(math.Abs).EltMax() == 0 {
+      t.Fatal("no gradient for H")
+   }
+   norm := n.ClipGradNorm(0.1)
+   clipped := 0.0
+   for _, d := range n.Delta() {
+      clipped += d.EltMul(d).EltSum()
+   }
+   if norm <= 0.1 || math.Abs(math.Sqrt(clipped) - 0.1) > 1e-12 {
+      t.Errorf("norm %v clipped to %v", norm, math.Sqrt(clipped))
+   }
+   if n.Grads()[h].Value.Add(H, 1, -0.1 / norm).Map(math.Abs).EltMax() > 1e-12 {
+      t.Error("H not clipped")
+   }
+   n.ZeroGrad()
+   if n.Grads()[h].Value.Map(math.Abs).EltMax() != 0 {
+      t.Error("H not zeroed")
+   }
+}
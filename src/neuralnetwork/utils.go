@@ -3,14 +3,18 @@ package neuralnetwork
 import (
    "math"
    "math/rand"
+   "sync"
    "time"
 )
 
+// Seed of the default Rand until SetDefaultSeed or RandomSeed, so that
+// programs and tests that do not seed anything run the same every time.
+const DefaultSeed int64 = 1
+
 var (
-   epsilon               float64 = 1e-9
-   global_guassian_cache float64 = 0.0
-   global_guassian_fast  bool    = false
-   last_chaos_random     float64 = 0.0
+   epsilon float64 = 1e-9
+   // shared by callers that do not hold their own Rand
+   default_rand *Rand = NewRand(DefaultSeed)
 )
 
 func LikeZero (x float64) bool {
@@ -21,45 +25,153 @@ func LikeInf (x float64) bool {
    return x >= math.Inf(1) || x <= math.Inf(-1)
 }
 
-func RandomSeed () {
-   rand.Seed(time.Now().Unix())
+// Random number generator with its own state; networks, initializers and
+// dropout layers seeded with the same value draw the same numbers no matter
+// what else runs in parallel. It is safe for concurrent use.
+type Rand struct {
+   lock sync.Mutex
+   source *rand.Rand
+   gaussianCache float64
+   gaussianFast bool
+   lastChaos float64
 }
 
-func RandomLinear (a, b float64) float64 {
-   return rand.Float64() * (b - a) + a
+func NewRand (seed int64) *Rand {
+   r := new(Rand)
+   r.source = rand.New(rand.NewSource(seed))
+   return r
 }
 
-func RandomChaos () float64 {
-   if LikeZero(last_chaos_random) {
-      last_chaos_random = rand.Float64()
+func DefaultRand () *Rand {
+   return default_rand
+}
+
+// Restart the sequence of r as NewRand(seed) would.
+func (r *Rand) Seed (seed int64) *Rand {
+   r.lock.Lock()
+   defer r.lock.Unlock()
+   r.source = rand.New(rand.NewSource(seed))
+   r.gaussianCache = 0
+   r.gaussianFast = false
+   r.lastChaos = 0
+   return r
+}
+
+func __rand_or_default__ (r *Rand) *Rand {
+   if r == nil {
+      return default_rand
+   }
+   return r
+}
+
+func (r *Rand) Float64 () float64 {
+   r.lock.Lock()
+   defer r.lock.Unlock()
+   return r.source.Float64()
+}
+
+func (r *Rand) Int63 () int64 {
+   r.lock.Lock()
+   defer r.lock.Unlock()
+   return r.source.Int63()
+}
+
+func (r *Rand) Intn (n int) int {
+   r.lock.Lock()
+   defer r.lock.Unlock()
+   return r.source.Intn(n)
+}
+
+func (r *Rand) Perm (n int) []int {
+   r.lock.Lock()
+   defer r.lock.Unlock()
+   return r.source.Perm(n)
+}
+
+func (r *Rand) Linear (a, b float64) float64 {
+   return r.Float64() * (b - a) + a
+}
+
+func (r *Rand) Chaos () float64 {
+   r.lock.Lock()
+   defer r.lock.Unlock()
+   if LikeZero(r.lastChaos) {
+      r.lastChaos = r.source.Float64()
    } else {
-      last_chaos_random = 4 * last_chaos_random * (1 - last_chaos_random)
+      r.lastChaos = 4 * r.lastChaos * (1 - r.lastChaos)
    }
-   return last_chaos_random
+   return r.lastChaos
 }
 
-func RandomStandardGuassian () float64 {
+func (r *Rand) StandardGaussian () float64 {
    // ref: https://github.com/karpathy/recurrentjs
-   if global_guassian_fast {
-      global_guassian_fast = false
-      return global_guassian_cache
+   r.lock.Lock()
+   defer r.lock.Unlock()
+   if r.gaussianFast {
+      r.gaussianFast = false
+      return r.gaussianCache
    }
    u := 0.0
    v := 0.0
    m := 0.0
    for m == 0.0 || m > 1.0 {
-      u = 2 * rand.Float64() - 1
-      v = 2 * rand.Float64() - 1
+      u = 2 * r.source.Float64() - 1
+      v = 2 * r.source.Float64() - 1
       m = u * u + v * v
    }
    m = math.Sqrt(-2 * math.Log(m) / m)
-   global_guassian_cache = v * m
-   global_guassian_fast = true
+   r.gaussianCache = v * m
+   r.gaussianFast = true
    return u * m
 }
 
-func RandomGuassian (mu, std float64) float64 {
-   return mu + RandomStandardGuassian() * std
+func (r *Rand) Gaussian (mu, std float64) float64 {
+   return mu + r.StandardGaussian() * std
+}
+
+func (r *Rand) FillRandom (X *SimpleMatrix, a, b float64) *SimpleMatrix {
+   for i := X.M - 1; i >= 0; i-- {
+      for j := X.N - 1; j >= 0; j-- {
+         X.Data[i][j] = r.Linear(a, b)
+      }
+   }
+   return X
+}
+
+func (r *Rand) FillGaussian (X *SimpleMatrix, mu, std float64) *SimpleMatrix {
+   for i := X.M - 1; i >= 0; i-- {
+      for j := X.N - 1; j >= 0; j-- {
+         X.Data[i][j] = r.Gaussian(mu, std)
+      }
+   }
+   return X
+}
+
+// Reseed the default Rand; it starts from DefaultSeed.
+func SetDefaultSeed (seed int64) {
+   default_rand.Seed(seed)
+}
+
+// Reseed the default Rand from the clock, for programs that want a
+// different run every time.
+func RandomSeed () {
+   SetDefaultSeed(time.Now().UnixNano())
+}
+
+func RandomLinear (a, b float64) float64 {
+   return default_rand.Linear(a, b)
+}
+
+func RandomChaos () float64 {
+   return default_rand.Chaos()
+}
+
+func RandomStandardGaussian () float64 {
+   return default_rand.StandardGaussian()
+}
+
+func RandomGaussian (mu, std float64) float64 {
+   return default_rand.Gaussian(mu, std)
 }
 
 func Sigmoid (x float64) float64 {
@@ -84,7 +196,7 @@ func Relu (x float64) float64 {
 
 func ReluDerivative(x float64) float64 {
    if x > 0 {
-      return x
+      return 1.0
    }
    return 0.0
 }
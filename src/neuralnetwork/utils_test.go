@@ -0,0 +1,97 @@
+package neuralnetwork
+
+import (
+   "sync"
+   "testing"
+)
+
+func buildTestXorChain (seed int64) *NeuralChain {
+   n := NewNeuralChain()
+   n.AddLayer(NewLayerLinear(1, 2, 8, 0, false))
+   n.AddLayer(MustLayerActivation(1, 8, "tanh"))
+   n.AddLayer(NewLayerDropout(1, 8, 0.1, 0))
+   n.AddLayer(NewLayerLinear(1, 8, 1, 0, false))
+   n.AddLayer(MustLayerActivation(1, 1, "sigmoid"))
+   return n.Seed(seed)
+}
+
+func trainTestXorChain (n *NeuralChain, steps int) []float64 {
+   data := NewSimpleMatrix(4, 3).FillElt([]float64{
+      0, 0, 0,
+      0, 1, 1,
+      1, 0, 1,
+      1, 1, 0,
+   })
+   trajectory := make([]float64, 0, steps)
+   for i := 0; i < steps; i++ {
+      k := n.Rand.Intn(4)
+      predict := n.Predict(data.Window(k, 0, 1, 2))
+      n.Learn(predict, data.Window(k, 2, 1, 1)).Update(0.2)
+      trajectory = append(trajectory, predict.Data[0][0])
+   }
+   return trajectory
+}
+
+func TestRandSameSeed (t *testing.T) {
+   a := NewRand(7)
+   b := NewRand(7)
+   for i := 0; i < 100; i++ {
+      if a.Float64() != b.Float64() || a.Gaussian(1, 2) != b.Gaussian(1, 2) || a.Chaos() != b.Chaos() {
+         t.Fail()
+      }
+   }
+}
+
+func TestSetDefaultSeed (t *testing.T) {
+   defer SetDefaultSeed(DefaultSeed)
+   SetDefaultSeed(5)
+   a := []float64{RandomLinear(0, 1), RandomGaussian(0, 1), RandomChaos()}
+   SetDefaultSeed(5)
+   b := []float64{RandomLinear(0, 1), RandomGaussian(0, 1), RandomChaos()}
+   expect := NewRand(5)
+   c := []float64{expect.Linear(0, 1), expect.Gaussian(0, 1), expect.Chaos()}
+   for i := range a {
+      if a[i] != b[i] || a[i] != c[i] {
+         t.Fatal(a, b, c)
+      }
+   }
+}
+
+func TestNeuralChainSeedWeights (t *testing.T) {
+   a := buildTestXorChain(42)
+   b := buildTestXorChain(42)
+   c := buildTestXorChain(43)
+   for _, i := range []int{0, 3} {
+      wa := a.Layers[i].(*LayerLinear).W
+      wb := b.Layers[i].(*LayerLinear).W
+      wc := c.Layers[i].(*LayerLinear).W
+      if wa.Add(wb, 1, -1).Map(func (x float64) float64 { return x * x }).EltSum() != 0 {
+         t.Fail()
+      }
+      if wa.Add(wc, 1, -1).Map(func (x float64) float64 { return x * x }).EltSum() == 0 {
+         t.Fail()
+      }
+   }
+}
+
+func TestNeuralChainSeedTrajectoryInParallel (t *testing.T) {
+   serial := trainTestXorChain(buildTestXorChain(42), 500)
+   trajectories := make([][]float64, 4)
+   var wg sync.WaitGroup
+   for i := range trajectories {
+      wg.Add(1)
+      go func (i int) {
+         defer wg.Done()
+         trajectories[i] = trainTestXorChain(buildTestXorChain(42), 500)
+      }(i)
+   }
+   wg.Wait()
+   for _, trajectory := range trajectories {
+      for k, v := range trajectory {
+         if v != serial[k] {
+            t.Fail()
+            return
+         }
+      }
+   }
+}
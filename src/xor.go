@@ -17,10 +17,10 @@ func main () {
    nn.RandomSeed()
    n := nn.NewNeuralChain()
    hidden := 16
-   n.AddLayer(nn.NewLayerLinear(1, 2, hidden, 0.5, 0, false))
-   n.AddLayer(nn.NewLayerActivation(1, hidden, "sigmoid"))
-   n.AddLayer(nn.NewLayerLinear(1, hidden, 1, 0.5, 0, false))
-   n.AddLayer(nn.NewLayerActivation(1, 1, "sigmoid"))
+   n.AddLayer(nn.NewLayerLinear(1, 2, hidden, 0, false))
+   n.AddLayer(nn.MustLayerActivation(1, hidden, "sigmoid"))
+   n.AddLayer(nn.NewLayerLinear(1, hidden, 1, 0, false))
+   n.AddLayer(nn.MustLayerActivation(1, 1, "sigmoid"))
 
    /*
       [0 0  0]